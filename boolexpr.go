@@ -0,0 +1,467 @@
+package godnf
+
+import (
+	"errors"
+	"fmt"
+)
+
+// BoolOp is the operator of a BoolExpr node
+type BoolOp int
+
+const (
+	BoolAmt BoolOp = iota // leaf node: a single assignment
+	BoolAnd               // conjunction of Args
+	BoolOr                // disjunction of Args
+	BoolNot               // negation of Args[0]
+)
+
+// BoolExpr is the syntax tree of an arbitrary nested boolean expression of assignments:
+//
+//	region in {SH} and (age in {3} or gender in {M}) and not (os in {ios} and ver in {1})
+//
+// parentheses use the conj delims of the syntax, keywords are the same as dnf
+type BoolExpr struct {
+	Pos  int // byte offset of this node
+	Op   BoolOp
+	Args []*BoolExpr // sub-expressions of BoolAnd, BoolOr and BoolNot
+	Amt  *Assignment // assignment of BoolAmt
+}
+
+// DefaultMaxConjunctions is the default limit of conjunctions generated from a BoolExpr
+const DefaultMaxConjunctions = 1024
+
+var neverMatchError error = errors.New("bool expression can never be matched")
+
+// ParseBoolExpr parses a boolean expression with the default syntax
+func ParseBoolExpr(s string) (*BoolExpr, error) {
+	return DefaultSyntax().ParseBoolExpr(s)
+}
+
+// ParseBoolExpr parses a boolean expression with this syntax
+func (s Syntax) ParseBoolExpr(str string) (*BoolExpr, error) {
+	p := &parser{src: str, syntax: s}
+	b, err := p.parseOr()
+	if err != nil {
+		return nil, err
+	}
+	if p.skipSpace(); !p.eof() {
+		return nil, p.errorAt(p.pos, "and", "or", "EOF")
+	}
+	return b, nil
+}
+
+// or: a or b or c
+func (p *parser) parseOr() (*BoolExpr, error) {
+	return p.parseBinary(BoolOr, p.parseAnd, "or", "||")
+}
+
+// and: a and b and c
+func (p *parser) parseAnd() (*BoolExpr, error) {
+	return p.parseBinary(BoolAnd, p.parseUnary, "and", "&&")
+}
+
+func (p *parser) parseBinary(op BoolOp, operand func() (*BoolExpr, error), keywords ...string) (*BoolExpr, error) {
+	p.skipSpace()
+	b := &BoolExpr{Pos: p.pos, Op: op}
+	for {
+		arg, err := operand()
+		if err != nil {
+			return nil, err
+		}
+		b.Args = append(b.Args, arg)
+
+		p.skipSpace()
+		start := p.pos
+		if !isKeyword(p.token(), keywords...) {
+			p.pos = start
+			break
+		}
+	}
+	if len(b.Args) == 1 {
+		return b.Args[0], nil
+	}
+	return b, nil
+}
+
+// unary: not unary, ( or ), or an assignment
+func (p *parser) parseUnary() (*BoolExpr, error) {
+	p.skipSpace()
+	start := p.pos
+	if p.peek() == p.syntax.LeftDelimOfConj {
+		p.next()
+		b, err := p.parseOr()
+		if err != nil {
+			return nil, err
+		}
+		if p.skipSpace(); p.peek() != p.syntax.RightDelimOfConj {
+			return nil, p.errorAt(p.pos, "and", "or", string(p.syntax.RightDelimOfConj))
+		}
+		p.next()
+		return b, nil
+	}
+
+	if isKeyword(p.token(), "not") {
+		// `not in {...}` means a key named not
+		p.skipSpace()
+		next := p.pos
+		tok := p.token()
+		p.pos = next
+		if !isKeyword(tok, "in", "under", "within") && tok != "=" && tok != "!=" {
+			arg, err := p.parseUnary()
+			if err != nil {
+				return nil, err
+			}
+			return &BoolExpr{Pos: start, Op: BoolNot, Args: []*BoolExpr{arg}}, nil
+		}
+	}
+
+	p.pos = start
+	amt, err := p.parseAmt()
+	if err != nil {
+		return nil, err
+	}
+	return &BoolExpr{Pos: start, Op: BoolAmt, Amt: amt}, nil
+}
+
+// DNF converts b to an Expr by De Morgan's laws and distribution,
+// it returns an error if more than maxConjs conjunctions would be generated.
+//
+// Assignments of the same key in a conjunction are merged into one,
+// and conjunctions which can never be matched are dropped,
+// ranges are compared as versions if any bound is not a number, see Handler.SetKeyType
+func (b *BoolExpr) DNF(maxConjs int) (*Expr, error) {
+	return b.toDNF(maxConjs, nil, nil)
+}
+
+// toDNF converts b to an Expr, ranges of key are compared as keyType(key) if keyType is not nil,
+// and conds may have several values of key if multi(key) is true, see mergeAmts
+func (b *BoolExpr) toDNF(maxConjs int, keyType func(key string) KeyType, multi func(key string) bool) (*Expr, error) {
+	conjs, err := b.dnf(false, maxConjs, keyType, multi)
+	if err != nil {
+		return nil, err
+	}
+	if len(conjs) == 0 {
+		return nil, neverMatchError
+	}
+	expr := &Expr{Conjs: make([]*Conjunction, 0, len(conjs))}
+	for _, amts := range conjs {
+		expr.Conjs = append(expr.Conjs, &Conjunction{Pos: amts[0].Pos, Amts: amts})
+	}
+	return expr, nil
+}
+
+func tooManyConjunctionsError(maxConjs int) error {
+	return fmt.Errorf("too many conjunctions(max: %d)", maxConjs)
+}
+
+// dnf returns conjunctions of b, or of `not b` if negate is true
+func (b *BoolExpr) dnf(negate bool, maxConjs int, keyType func(string) KeyType, multi func(string) bool) ([][]*Assignment, error) {
+	switch b.Op {
+	case BoolAmt:
+		amt := *b.Amt
+		amt.Belong = amt.Belong != negate
+		return [][]*Assignment{{&amt}}, nil
+	case BoolNot:
+		return b.Args[0].dnf(!negate, maxConjs, keyType, multi)
+	}
+
+	// not (a and b) == not a or not b, not (a or b) == not a and not b
+	isAnd := (b.Op == BoolAnd) != negate
+
+	var conjs [][]*Assignment
+	for i, arg := range b.Args {
+		argConjs, err := arg.dnf(negate, maxConjs, keyType, multi)
+		if err != nil {
+			return nil, err
+		}
+		switch {
+		case i == 0:
+			conjs = argConjs
+		case isAnd:
+			// (a or b) and (c or d) == (a and c) or (a and d) or (b and c) or (b and d)
+			product := make([][]*Assignment, 0, len(conjs)*len(argConjs))
+			for _, left := range conjs {
+				for _, right := range argConjs {
+					amts := make([]*Assignment, 0, len(left)+len(right))
+					amts = append(append(amts, left...), right...)
+					if amts, ok := mergeAmts(amts, keyType, multi); ok {
+						product = append(product, amts)
+					}
+					if len(product) > maxConjs {
+						return nil, tooManyConjunctionsError(maxConjs)
+					}
+				}
+			}
+			conjs = product
+		default:
+			conjs = append(conjs, argConjs...)
+		}
+		if len(conjs) > maxConjs {
+			return nil, tooManyConjunctionsError(maxConjs)
+		}
+	}
+	return conjs, nil
+}
+
+// mergeAmts merges assignments of the same key or bucket:
+//
+//	k in A and k not in B     --> k in A - B
+//	k in A and k in B         --> k in A ∩ B
+//	k not in A and k not in B --> k not in A ∪ B
+//	k in R1 and k in R2       --> k in R1 ∩ R2 (R1, R2 are ranges)
+//	k in A and k [not] in R   --> k in {a | a ∈ A and a [∉] ∈ R}
+//	has k and k in A          --> k in A, see mergeExists
+//
+// assignments of keys which conds may have several values of, told by multi, are merged by mergeMultiAmt,
+// assignments which can not be merged are kept as is,
+// it returns false if the conjunction can never be matched
+func mergeAmts(amts []*Assignment, keyType func(string) KeyType, multi func(string) bool) ([]*Assignment, bool) {
+	merged := make([]*Assignment, 0, len(amts))
+	for _, amt := range amts {
+		cp := *amt
+		cp.Vals = append([]string(nil), amt.Vals...)
+		merged = append(merged, &cp)
+	}
+
+	for changed := true; changed; {
+		changed = false
+		for i := 0; i < len(merged); i++ {
+			for j := i + 1; j < len(merged); j++ {
+				if merged[i].target() != merged[j].target() {
+					continue
+				}
+				amts, ok := mergeAmt(merged[i], merged[j], keyType, multi)
+				if !ok {
+					return nil, false
+				}
+				switch len(amts) {
+				case 0:
+					continue
+				case 1:
+					merged[i] = amts[0]
+					merged = append(merged[:j], merged[j+1:]...)
+					j--
+				default:
+					merged[i], merged[j] = amts[0], amts[1]
+				}
+				changed = true
+			}
+		}
+	}
+	return merged, true
+}
+
+// isMulti reports whether conds may have several values of key, multi tells it if not nil
+func isMulti(multi func(string) bool, key string) bool {
+	return multi != nil && multi(key)
+}
+
+// mergeAmt merges two assignments of the same key, it returns the assignments replacing a and b in order,
+// nil if they are kept as is, and false if they can never be matched together
+func mergeAmt(a, b *Assignment, keyType func(string) KeyType, multi func(string) bool) ([]*Assignment, bool) {
+	if a.Exists || b.Exists {
+		amt, ok := mergeExists(a, b)
+		if amt == nil {
+			return nil, ok
+		}
+		return []*Assignment{amt}, ok
+	}
+	if a.opaque() || b.opaque() {
+		return nil, true
+	}
+	if isMulti(multi, a.Key) {
+		return mergeMultiAmt(a, b, keyType, multi)
+	}
+	amt, ok := mergeSingleAmt(a, b, keyType)
+	if amt == nil {
+		return nil, ok
+	}
+	return []*Assignment{amt}, ok
+}
+
+// mergeSingleAmt merges two assignments of a key of at most one value into a new one,
+// it returns nil if they can not be merged, and false if they can never be matched together
+func mergeSingleAmt(a, b *Assignment, keyType func(string) KeyType) (*Assignment, bool) {
+	t := amtKeyType(a, b, keyType)
+
+	if a.Range != nil && b.Range != nil {
+		switch {
+		case a.Belong && b.Belong:
+			r := a.Range.intersect(t, b.Range)
+			if r == nil {
+				return nil, false
+			}
+			return &Assignment{Pos: a.Pos, Key: a.Key, Belong: true, Range: r}, true
+		case a.Belong == b.Belong && a.Range.canonical(t) == b.Range.canonical(t):
+			return a, true
+		}
+		return nil, true
+	}
+
+	if a.Range != nil || b.Range != nil {
+		set, r := a, b
+		if a.Range != nil {
+			set, r = b, a
+		}
+		if !set.Belong {
+			return nil, true
+		}
+		vals := make([]string, 0, len(set.Vals))
+		for _, val := range set.Vals {
+			x, err := parseBound(t, val)
+			if (err == nil && r.Range.contains(t, x)) == r.Belong {
+				vals = append(vals, val)
+			}
+		}
+		if len(vals) == 0 {
+			return nil, false
+		}
+		return &Assignment{Pos: set.Pos, Key: set.Key, Belong: true, Vals: vals}, true
+	}
+
+	rc := &Assignment{Pos: a.Pos, Key: a.Key}
+	switch {
+	case a.Belong && b.Belong:
+		rc.Belong, rc.Vals = true, filterVals(a.Vals, b.Vals, true)
+	case a.Belong && !b.Belong:
+		rc.Belong, rc.Vals = true, filterVals(a.Vals, b.Vals, false)
+	case !a.Belong && b.Belong:
+		rc.Belong, rc.Vals = true, filterVals(b.Vals, a.Vals, false)
+	default:
+		rc.Vals = append(append([]string(nil), a.Vals...), filterVals(b.Vals, a.Vals, false)...)
+	}
+	if rc.Belong && len(rc.Vals) == 0 {
+		return nil, false
+	}
+	return rc, true
+}
+
+// mergeMultiAmt merges two assignments of a key of several values, see KeySchema.Multi,
+// an `in` is satisfied by any value of conds and a `not in` is violated by any value:
+//
+//	k in A and k not in B     --> k in A - B and k not in B
+//	k in A and k in B         --> k in A (A ⊆ B, R1 ⊆ R2 or all values of A are in R)
+//	k not in A and k not in B --> k not in A ∪ B (A, B are sets)
+//
+// it returns the assignments replacing a and b like mergeAmt
+func mergeMultiAmt(a, b *Assignment, keyType func(string) KeyType, multi func(string) bool) ([]*Assignment, bool) {
+	switch {
+	case a.Belong && b.Belong:
+		// a value in the narrower one is in both
+		if implies(a, b, keyType, multi) {
+			return []*Assignment{a}, true
+		} else if implies(b, a, keyType, multi) {
+			return []*Assignment{b}, true
+		}
+		return nil, true
+	case !a.Belong && !b.Belong:
+		if a.Range == nil && b.Range == nil {
+			vals := append(append([]string(nil), a.Vals...), filterVals(b.Vals, a.Vals, false)...)
+			return []*Assignment{{Pos: a.Pos, Key: a.Key, Vals: vals}}, true
+		}
+		if implies(a, b, keyType, multi) {
+			return []*Assignment{a}, true
+		} else if implies(b, a, keyType, multi) {
+			return []*Assignment{b}, true
+		}
+		return nil, true
+	}
+
+	pos, neg := a, b
+	if !a.Belong {
+		pos, neg = b, a
+	}
+	excluded := *neg
+	excluded.Belong = true
+	if implies(pos, &excluded, keyType, multi) {
+		// any value in pos is in neg
+		return nil, false
+	}
+	if pos.Range != nil {
+		return nil, true
+	}
+	t := amtKeyType(a, b, keyType)
+	vals := make([]string, 0, len(pos.Vals))
+	for _, val := range pos.Vals {
+		in := false
+		if neg.Range != nil {
+			x, err := parseBound(t, val)
+			in = err == nil && neg.Range.contains(t, x)
+		} else {
+			in = len(filterVals([]string{val}, neg.Vals, true)) != 0
+		}
+		if !in {
+			vals = append(vals, val)
+		}
+	}
+	if len(vals) == len(pos.Vals) {
+		return nil, true
+	}
+	// neg is kept, since other values of conds may be in it
+	pos = &Assignment{Pos: pos.Pos, Key: pos.Key, Belong: true, Vals: vals}
+	if a.Belong {
+		return []*Assignment{pos, neg}, true
+	}
+	return []*Assignment{neg, pos}, true
+}
+
+// amtKeyType returns the type of values of assignments a and b of the same target,
+// which is told by keyType, or inferred from their ranges if keyType is nil
+func amtKeyType(a, b *Assignment, keyType func(string) KeyType) KeyType {
+	switch {
+	case a.Bucket != nil:
+		return NumberKey
+	case keyType != nil:
+		return keyType(a.Key)
+	case a.Range != nil && a.Range.keyType() == VersionKey, b.Range != nil && b.Range.keyType() == VersionKey:
+		return VersionKey
+	}
+	return NumberKey
+}
+
+// mergeExists merges has or missing key with another assignment of key:
+//
+//	has k and k in A         --> k in A
+//	missing k and k not in A --> missing k
+//	missing k and k in A     --> never matched
+func mergeExists(a, b *Assignment) (*Assignment, bool) {
+	e, x := a, b
+	if !a.Exists {
+		e, x = b, a
+	}
+	switch {
+	case x.Exists:
+		return e, e.Belong == x.Belong
+	case x.Geo != nil || x.Week != nil:
+		// keys of areas and windows are not in conds
+		return nil, true
+	case e.Belong && x.Belong:
+		return x, true
+	case !e.Belong && x.Belong:
+		return nil, false
+	case !e.Belong:
+		return e, true
+	}
+	return nil, true
+}
+
+// opaque reports whether amt is kept as is when merging assignments:
+// paths, prefixes, areas, time windows and named sets, which are known only by handler
+func (amt *Assignment) opaque() bool {
+	return amt.Under || amt.CIDR || amt.Geo != nil || amt.Week != nil || amt.NamedSet != ""
+}
+
+// filterVals returns vals which are (keep == true) or are not (keep == false) in other
+func filterVals(vals, other []string, keep bool) []string {
+	m := make(map[string]bool, len(other))
+	for _, val := range other {
+		m[val] = true
+	}
+	rc := make([]string, 0, len(vals))
+	for _, val := range vals {
+		if m[val] == keep {
+			rc = append(rc, val)
+		}
+	}
+	return rc
+}
@@ -0,0 +1,124 @@
+package godnf_test
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+	"testing"
+
+	dnf "github.com/brg-liuwei/godnf"
+)
+
+func TestBoolExprDNF(t *testing.T) {
+	setDelim()
+	checkDNF := func(s, expected string) {
+		b, err := dnf.ParseBoolExpr(s)
+		if err != nil {
+			t.Errorf("unexpected error when ParseBoolExpr %q: %v", s, err)
+			return
+		}
+		expr, err := b.DNF(dnf.DefaultMaxConjunctions)
+		if err != nil {
+			t.Errorf("unexpected error when DNF %q: %v", s, err)
+			return
+		}
+		if got := dnf.DefaultSyntax().Print(expr); got != expected {
+			t.Errorf("dnf of %q:\n  got:    %s\n  expect: %s", s, got, expected)
+		}
+	}
+
+	checkDNF("region in {SH}", "(region in {SH})")
+	checkDNF("(region in {SH}) or (age in {3} and gender = M)", "(region in {SH}) or (age in {3} and gender in {M})")
+	checkDNF("region in {SH} and (age in {3} or gender in {M}) and not (os in {ios} and ver in {1})",
+		"(region in {SH} and age in {3} and os not in {ios}) or "+
+			"(region in {SH} and age in {3} and ver not in {1}) or "+
+			"(region in {SH} and gender in {M} and os not in {ios}) or "+
+			"(region in {SH} and gender in {M} and ver not in {1})")
+	checkDNF("NOT (region in {SH} || age != 3)", "(region not in {SH} and age in {3})")
+	checkDNF("not not region in {SH}", "(region in {SH})")
+	checkDNF("not in {SH}", "(not in {SH})")
+
+	// assignments of the same key are merged
+	checkDNF("region in {SH, BJ, GZ} and not region in {BJ} and (region in {SH, GZ, HZ} or age in {3})",
+		"(region in {SH, GZ}) or (region in {SH, GZ} and age in {3})")
+	checkDNF("region not in {SH} and region not in {BJ}", "(region not in {SH, BJ})")
+	checkDNF("(region in {SH} and region in {BJ}) or age in {3}", "(age in {3})")
+
+	if b, err := dnf.ParseBoolExpr("region in {SH} and not region in {SH}"); err != nil {
+		t.Error("unexpected error when ParseBoolExpr: ", err)
+	} else if _, err := b.DNF(dnf.DefaultMaxConjunctions); err == nil {
+		t.Error("expect error when DNF an expression never matched")
+	}
+
+	for _, s := range []string{
+		"region in {SH} and",
+		"(region in {SH} or age in {3}",
+		"region in {SH})",
+		"not",
+	} {
+		if _, err := dnf.ParseBoolExpr(s); err == nil {
+			t.Error("expect error when ParseBoolExpr: ", s)
+		}
+	}
+}
+
+func TestBoolExprTooManyConjunctions(t *testing.T) {
+	setDelim()
+	ors := make([]string, 0, 11)
+	for i := 0; i != 11; i++ {
+		ors = append(ors, fmt.Sprintf("(k%d in {a} or k%d in {b})", i, i))
+	}
+	s := strings.Join(ors, " and ") // 2^11 conjunctions
+
+	h := dnf.NewHandlerWithoutLock()
+	if err := h.AddBoolExpr("doc-0", "0", s, attr{0, "doc-0"}); err == nil {
+		t.Error("expect error when AddBoolExpr with too many conjunctions")
+	} else if err.Error() != "too many conjunctions(max: 1024)" {
+		t.Error("unexpected error message: ", err)
+	}
+
+	h.SetMaxConjunctions(2048)
+	if h.MaxConjunctions() != 2048 {
+		t.Error("unexpected max conjunctions: ", h.MaxConjunctions())
+	}
+	if err := h.AddBoolExpr("doc-0", "0", s, attr{0, "doc-0"}); err != nil {
+		t.Error("unexpected error when AddBoolExpr: ", err)
+	}
+}
+
+func TestAddBoolExpr(t *testing.T) {
+	h := dnf.NewHandlerWithoutLock()
+	s := "region in {SH} and (age in {3} or gender in {M}) and not (os in {ios} and ver in {1})"
+	if err := h.AddBoolExpr("doc-0", "0", s, attr{0, "doc-0"}); err != nil {
+		t.Fatal("unexpected error when AddBoolExpr: ", err)
+	}
+
+	search := func(conds ...dnf.Cond) int {
+		docs, err := h.SearchAll(conds)
+		if err != nil {
+			t.Fatal("unexpected error when Search: ", err)
+		}
+		return len(docs)
+	}
+	if n := search(dnf.Cond{"region", "SH"}, dnf.Cond{"age", "3"}); n != 1 {
+		t.Error("expect 1 doc, got ", n)
+	}
+	if n := search(dnf.Cond{"region", "SH"}, dnf.Cond{"gender", "M"}, dnf.Cond{"os", "ios"}); n != 1 {
+		t.Error("expect 1 doc, got ", n)
+	}
+	if n := search(dnf.Cond{"region", "SH"}, dnf.Cond{"gender", "M"}, dnf.Cond{"os", "ios"}, dnf.Cond{"ver", "1"}); n != 0 {
+		t.Error("expect 0 doc, got ", n)
+	}
+	if n := search(dnf.Cond{"region", "BJ"}, dnf.Cond{"age", "3"}); n != 0 {
+		t.Error("expect 0 doc, got ", n)
+	}
+
+	var m map[string]map[string]interface{}
+	json.Unmarshal(h.DumpByDocId(), &m)
+	if m["0"]["bool_expr"] != s {
+		t.Error("unexpected bool_expr of dump: ", m["0"]["bool_expr"])
+	}
+	if err := dnf.DnfCheck(m["0"]["dnf"].(string)); err != nil {
+		t.Error("unexpected error when DnfCheck generated dnf: ", err)
+	}
+}
@@ -0,0 +1,168 @@
+package godnf
+
+import (
+	"hash/fnv"
+	"strconv"
+)
+
+// Bucket hashes values of a key into Mod buckets for traffic splitting:
+//
+//	bucket(user_id, 1000, exp42) in [0, 50)
+//
+// matches 5% of user ids, the salt decorrelates buckets of different experiments
+type Bucket struct {
+	Mod  int    `json:"mod"`
+	Salt string `json:"salt,omitempty"`
+}
+
+// BucketOf returns the bucket of val in [0, mod), which is the 64-bit FNV-1a hash
+// of salt, a zero byte and val modulo mod, so other services can compute the same bucket
+func BucketOf(val string, mod int, salt string) int {
+	h := fnv.New64a()
+	h.Write([]byte(salt))
+	h.Write([]byte{0})
+	h.Write([]byte(val))
+	return int(h.Sum64() % uint64(mod))
+}
+
+// String prints b of key in the default syntax
+func (b *Bucket) String(key string) string {
+	return DefaultSyntax().printBucket(key, b)
+}
+
+func (s Syntax) printBucket(key string, b *Bucket) string {
+	sep := string(s.SeparatorOfSet) + " "
+	str := "bucket" + string(s.LeftDelimOfConj) + s.quote(key) + sep + strconv.Itoa(b.Mod)
+	if b.Salt != "" {
+		str += sep + s.quote(b.Salt)
+	}
+	return str + string(s.RightDelimOfConj)
+}
+
+// target returns what amt constrains, the key or the bucket of the key,
+// a conjunction can constrain a target only once
+func (amt *Assignment) target() string {
+	if amt.Bucket != nil {
+		return amt.Bucket.String(amt.Key)
+	}
+	return amt.Key
+}
+
+// bucket: bucket(user_id, 1000) or bucket(user_id, 1000, salt), "bucket(" is scanned
+func (p *parser) parseBucket() (key string, b *Bucket, err error) {
+	p.skipSpace()
+	if key, err = p.literal(p.word, "key"); err != nil {
+		return "", nil, err
+	}
+	if p.skipSpace(); p.peek() != p.syntax.SeparatorOfSet {
+		return "", nil, p.errorAt(p.pos, string(p.syntax.SeparatorOfSet))
+	}
+	p.next()
+
+	p.skipSpace()
+	start := p.pos
+	mod, err := strconv.Atoi(p.word())
+	if err != nil || mod <= 0 {
+		return "", nil, p.errorAt(start, "positive integer")
+	}
+	b = &Bucket{Mod: mod}
+
+	if p.skipSpace(); p.peek() == p.syntax.SeparatorOfSet {
+		p.next()
+		p.skipSpace()
+		if b.Salt, err = p.literal(p.word, "salt"); err != nil {
+			return "", nil, err
+		}
+		p.skipSpace()
+	}
+	if p.peek() != p.syntax.RightDelimOfConj {
+		return "", nil, p.errorAt(p.pos, string(p.syntax.SeparatorOfSet), string(p.syntax.RightDelimOfConj))
+	}
+	p.next()
+	return key, b, nil
+}
+
+type bucketFunc struct {
+	mod  int
+	salt string
+}
+
+// String prints fn like bucket(1000, "exp42") for bucket terms
+func (fn bucketFunc) String() string {
+	if fn.salt == "" {
+		return "bucket(" + strconv.Itoa(fn.mod) + ")"
+	}
+	return "bucket(" + strconv.Itoa(fn.mod) + ", " + strconv.Quote(fn.salt) + ")"
+}
+
+// bucketIndexAdd indexes bucket range term of key
+func (h *Handler) bucketIndexAdd(key string, b *Bucket, r *Range, termId int) {
+	lo, hi, _ := r.bounds(NumberKey)
+
+	h.rangesLock.Lock()
+	defer h.rangesLock.Unlock()
+	indexes, ok := h.buckets[key]
+	if !ok {
+		indexes = make(map[bucketFunc]*numIndex)
+		h.buckets[key] = indexes
+	}
+	fn := bucketFunc{mod: b.Mod, salt: b.Salt}
+	idx, ok := indexes[fn]
+	if !ok {
+		idx = newNumIndex(NumberKey)
+		indexes[fn] = idx
+	}
+	idx.add(newNumInterval(r, lo, hi, termId))
+}
+
+// bucketLookup appends ids of bucket range terms matched by conds to termids
+func (h *Handler) bucketLookup(conds []Cond, termids []int) []int {
+	h.rangesLock.RLock()
+	defer h.rangesLock.RUnlock()
+	if len(h.buckets) == 0 {
+		return termids
+	}
+	for i := range conds {
+		for fn, idx := range h.buckets[conds[i].Key] {
+			x := number(BucketOf(conds[i].Val, fn.mod, fn.salt))
+			termids = idx.lookup(x, termids)
+		}
+	}
+	return termids
+}
+
+// bucket range: in [0, 50), not in [0, 50) or < 50, "bucket(...)" is scanned
+func (p *parser) parseBucketRange() (r *Range, belong bool, err error) {
+	p.skipSpace()
+	start := p.pos
+	switch op := p.token(); {
+	case isComparison(op):
+		belong = true
+		if r, err = p.parseComparison(op); err != nil {
+			return nil, false, err
+		}
+	case isKeyword(op, "not"), isKeyword(op, "in"):
+		belong = isKeyword(op, "in")
+		if !belong {
+			p.skipSpace()
+			if start = p.pos; !isKeyword(p.token(), "in") {
+				return nil, false, p.errorAt(start, "in")
+			}
+		}
+		if p.skipSpace(); p.peek() != '[' && p.peek() != '(' {
+			return nil, false, p.errorAt(p.pos, "[", "(")
+		}
+		start = p.pos
+		if r, err = p.parseRange(); err != nil {
+			return nil, false, err
+		}
+	default:
+		return nil, false, p.errorAt(start, "in", "not", "<", "<=", ">", ">=")
+	}
+	if msg, ok := r.check(NumberKey); !ok {
+		perr := p.errorAt(start)
+		perr.Msg = msg
+		return nil, false, perr
+	}
+	return r, belong, nil
+}
@@ -0,0 +1,112 @@
+package godnf_test
+
+import (
+	"strconv"
+	"testing"
+
+	dnf "github.com/brg-liuwei/godnf"
+)
+
+func TestParseBucket(t *testing.T) {
+	setDelim()
+	for _, c := range []struct {
+		dnf      string
+		expected string
+	}{
+		{"(bucket(user_id, 1000, exp42) in [0, 50) and region in {SH})", "(bucket(user_id, 1000, exp42) in [0, 50) and region in {SH})"},
+		{"(bucket( user_id ,100 ) < 5)", "(bucket(user_id, 100) < 5)"},
+		{"(bucket(user_id, 100) not in [0, 5) and bucket(user_id, 100, b) >= 95 and user_id in {42})",
+			"(bucket(user_id, 100) not in [0, 5) and bucket(user_id, 100, b) >= 95 and user_id in {42})"},
+		{`("bucket" in {a})`, "(bucket in {a})"},
+	} {
+		expr, err := dnf.ParseDNF(c.dnf)
+		if err != nil {
+			t.Errorf("unexpected error when ParseDNF %q: %v", c.dnf, err)
+			continue
+		}
+		if got := expr.String(); got != c.expected {
+			t.Errorf("unexpected dnf of %q: %s", c.dnf, got)
+		}
+	}
+
+	b, err := dnf.DNFToJSON("(bucket(user_id, 1000, exp42) in [0, 50))")
+	if err != nil {
+		t.Fatal("unexpected error when DNFToJSON: ", err)
+	}
+	if string(b) != `{"or":[{"and":[{"key":"user_id","bucket":{"mod":1000,"salt":"exp42"},"in_range":{"gte":"0","lt":"50"}}]}]}` {
+		t.Error("unexpected json: ", string(b))
+	}
+	if s, err := dnf.JSONToDNF(b); err != nil || s != "(bucket(user_id, 1000, exp42) in [0, 50))" {
+		t.Error("unexpected dnf from json: ", s, err)
+	}
+
+	for _, s := range []string{
+		"(bucket(user_id) in [0, 50))",
+		"(bucket(user_id, 0) in [0, 50))",
+		"(bucket(user_id, 100) in {1, 2})",
+		"(bucket(user_id, 100) = 1)",
+		"(bucket(user_id, 100) in [1.2.3, 2))",
+		"(bucket(user_id, 100, a, b) in [0, 5))",
+		"(bucket(user_id, 100) in [0, 5) and bucket(user_id, 100) < 3)",
+	} {
+		if err := dnf.DnfCheck(s); err == nil {
+			t.Error("expect error when DnfCheck: ", s)
+		}
+	}
+}
+
+func TestBucketRetrieval(t *testing.T) {
+	h := dnf.NewHandlerWithoutLock()
+	for i, s := range []string{
+		"(bucket(user_id, 1000, exp42) in [0, 50))",                        // docid: 0
+		"(bucket(user_id, 1000, exp42) not in [0, 50) and region in {SH})", // docid: 1
+		"(bucket(user_id, 1000) < 50)",                                     // docid: 2
+	} {
+		if err := h.AddDoc("doc", strconv.Itoa(i), s, attr{i, "doc"}); err != nil {
+			t.Fatal("unexpected error when AddDoc: ", err)
+		}
+	}
+
+	n0, n2, both := 0, 0, 0
+	for i := 0; i != 1000; i++ {
+		uid := "u" + strconv.Itoa(i)
+		in0 := dnf.BucketOf(uid, 1000, "exp42") < 50
+		in2 := dnf.BucketOf(uid, 1000, "") < 50
+		expected := []int{1}
+		if in0 {
+			expected = []int{0}
+			n0++
+		}
+		if in2 {
+			expected = append(expected, 2)
+			n2++
+		}
+		if in0 && in2 {
+			both++
+		}
+
+		docs, err := h.SearchAll([]dnf.Cond{{"user_id", uid}, {"region", "SH"}})
+		if err != nil {
+			t.Fatal("unexpected error when Search: ", err)
+		}
+		if !sameDocs(h, docs, expected) {
+			t.Errorf("unexpected docs of %s: %v, expect %v", uid, docs, expected)
+		}
+	}
+	if n0 < 20 || n0 > 80 || n2 < 20 || n2 > 80 || both > 15 {
+		t.Errorf("unexpected bucket distribution: %d, %d, %d", n0, n2, both)
+	}
+}
+
+func TestBucketOf(t *testing.T) {
+	// buckets must never change, other services compute the same buckets
+	if b := dnf.BucketOf("u1", 1000, "exp42"); b != 944 {
+		t.Error("unexpected bucket: ", b)
+	}
+	if b := dnf.BucketOf("user-7", 100, ""); b != 0 {
+		t.Error("unexpected bucket: ", b)
+	}
+	if dnf.BucketOf("", 1, "") != 0 {
+		t.Error("unexpected bucket of mod 1")
+	}
+}
@@ -1,8 +1,11 @@
 package godnf
 
 import (
+	"encoding/json"
 	"errors"
+	"net"
 	"sort"
+	"strconv"
 )
 
 var conjSizeTooLargeError error = errors.New("conjunction size too large(max: 255)")
@@ -29,55 +32,109 @@ func (h *Handler) DeleteDoc(docid, comment string) bool {
 	return false
 }
 
+func (h *Handler) docAddedCheck(docid string) error {
+	h.docs.RLock()
+	defer h.docs.RUnlock()
+	if _, ok := h.docs.docMap[docid]; ok {
+		return errors.New("doc " + docid + " has been added before")
+	}
+	return nil
+}
+
 // add new doc and insert infos into reverse lists
 func (h *Handler) AddDoc(name string, docid string, dnfDesc string, attr DocAttr) error {
-	f := func() error {
-		h.docs.RLock()
-		defer h.docs.RUnlock()
-		if _, ok := h.docs.docMap[docid]; ok {
-			return errors.New("doc " + docid + " has been added before")
-		}
-		return nil
+	return h.AddDocWithOptions(name, docid, dnfDesc, attr, AddOptions{})
+}
+
+// AddDocWithOptions adds a doc like AddDoc with options
+func (h *Handler) AddDocWithOptions(name string, docid string, dnfDesc string, attr DocAttr, opts AddOptions) error {
+	if err := h.docAddedCheck(docid); err != nil {
+		return err
 	}
 
-	if err := f(); err != nil {
+	expr, err := h.syntax.Parse(dnfDesc)
+	if err != nil {
 		return err
 	}
+	return h.doAddDoc(name, docid, expr, "", attr, opts.Simplify)
+}
 
-	if err := DnfCheck(dnfDesc); err != nil {
+// AddDocJSON adds a doc described by the JSON representation of dnf like
+// {"or": [{"and": [{"key": "region", "in": ["SH"]}, {"key": "age", "not_in": ["3"]}]}]}
+func (h *Handler) AddDocJSON(name string, docid string, dnfJSON []byte, attr DocAttr) error {
+	if err := h.docAddedCheck(docid); err != nil {
+		return err
+	}
+
+	var expr Expr
+	if err := json.Unmarshal(dnfJSON, &expr); err != nil {
+		return err
+	}
+	return h.doAddDoc(name, docid, &expr, "", attr, false)
+}
+
+// AddBoolExpr adds a doc described by an arbitrary nested boolean expression like
+// region in {SH} and (age in {3} or gender in {M}) and not (os in {ios} and ver in {1}),
+// the expression is converted to dnf before indexing, see BoolExpr.DNF
+func (h *Handler) AddBoolExpr(name string, docid string, boolExpr string, attr DocAttr) error {
+	if err := h.docAddedCheck(docid); err != nil {
+		return err
+	}
+
+	b, err := h.syntax.ParseBoolExpr(boolExpr)
+	if err != nil {
+		return err
+	}
+	expr, err := b.toDNF(h.MaxConjunctions(), h.KeyType, h.multiKey)
+	if err != nil {
 		return err
 	}
-	return h.doAddDoc(name, docid, dnfDesc, attr)
+	return h.doAddDoc(name, docid, expr, boolExpr, attr, false)
 }
 
-func (h *Handler) doAddDoc(name string, docid string, dnf string, attr DocAttr) error {
+func (h *Handler) doAddDoc(name string, docid string, expr *Expr, boolExpr string, attr DocAttr, simplify bool) error {
+	orig, normalized := expr, ""
+	if expr = h.normalize(expr); h.hasNormalizers() {
+		normalized = h.syntax.Print(expr)
+	}
+	if err := h.schemaCheck(expr); err != nil {
+		return err
+	}
+	if err := h.keyTypeCheck(expr); err != nil {
+		return err
+	}
+	if err := h.geoCheck(expr); err != nil {
+		return err
+	}
+	if err := h.namedSetCheck(expr); err != nil {
+		return err
+	}
 	doc := &Doc{
-		docid:   docid,
-		name:    name,
-		dnf:     dnf,
-		conjs:   make([]int, 0),
-		attr:    attr,
-		active:  true,
-		comment: "",
-	}
-
-	var conjId int
-	var orStr string
-
-	i := skipSpace(&dnf, 0)
-	var err error
-	for {
-		if i, conjId, err = h.conjParse(&dnf, i); err != nil {
+		docid:      docid,
+		name:       name,
+		dnf:        h.syntax.Print(orig),
+		normalized: normalized,
+		expr:       orig,
+		boolExpr:   boolExpr,
+		attr:       attr,
+		active:     true,
+		comment:    "",
+	}
+	if simplify {
+		var err error
+		if expr, err = expr.simplify(h.KeyType, h.multiKey); err != nil {
 			return err
 		}
-		doc.conjs = append(doc.conjs, conjId)
-		i = skipSpace(&dnf, i+1)
-		if i >= len(dnf) {
-			break
+		doc.simplified = h.syntax.Print(expr)
+	}
+	doc.conjs = make([]int, 0, len(expr.Conjs))
+
+	for _, conj := range expr.Conjs {
+		conjId, err := h.conjBuild(conj)
+		if err != nil {
+			return err
 		}
-		orStr, i = getString(&dnf, i)
-		ASSERT(orStr == "or")
-		i = skipSpace(&dnf, i+1)
+		doc.conjs = append(doc.conjs, conjId)
 	}
 	docInternalId := h.docs.Add(doc, h)
 	h.conjReverse1(docInternalId, doc.conjs)
@@ -85,81 +142,91 @@ func (h *Handler) doAddDoc(name string, docid string, dnf string, attr DocAttr)
 }
 
 // conj: ( age in {3, 4} and state not in {CA, NY } )
-func (h *Handler) conjParse(dnf *string, i int) (endIndex int, conjId int, err error) {
-	var key, val string
-	var vals []string
-	var belong bool
-	var op string // "in" or "not in"
-
-	conj := &Conj{amts: make([]int, 0)}
-
-	ASSERT((*dnf)[i] == leftDelimOfConj)
-
-	for {
-		// get assignment key
-		i = skipSpace(dnf, i+1)
-		key, i = getString(dnf, i)
-
-		// get assignment op
-		i = skipSpace(dnf, i)
-		op, i = getString(dnf, i)
-		if op == "in" {
-			belong = true
-		} else {
-			ASSERT(op == "not")
-			i = skipSpace(dnf, i)
-			op, i = getString(dnf, i)
-			ASSERT(op == "in")
-			belong = false
-		}
-
-		// get assignment vals
-		i = skipSpace(dnf, i)
-		ASSERT((*dnf)[i] == leftDelimOfSet)
-		vals = make([]string, 0, 1)
-		for {
-			i = skipSpace(dnf, i+1)
-			val, i = getString(dnf, i)
-			vals = append(vals, val)
-			i = skipSpace(dnf, i)
-			if (*dnf)[i] == rightDelimOfSet {
-				break
-			}
-			ASSERT((*dnf)[i] == separatorOfSet)
+func (h *Handler) conjBuild(c *Conjunction) (conjId int, err error) {
+	conj := &Conj{amts: make([]int, 0, len(c.Amts))}
+	for _, amt := range c.Amts {
+		amtId, err := h.amtBuild(amt)
+		if err != nil {
+			return -1, err
 		}
-		amtId := h.amtBuild(key, vals, belong)
 		conj.amts = append(conj.amts, amtId)
-		if belong {
+		if amt.Belong {
 			conj.size++
 			if conj.size > 255 { // 255 == max(uint8)
-				return -1, -1, conjSizeTooLargeError
+				return -1, conjSizeTooLargeError
 			}
 		}
+	}
+	conjId = h.conjs.Add(conj, h)
 
-		// get next assignment or end of this conjunction
-		i = skipSpace(dnf, i+1)
-		if (*dnf)[i] == rightDelimOfConj {
-			conjId = h.conjs.Add(conj, h)
-			endIndex = i
+	// reverse list insert
+	h.conjReverse2(conj)
+	return conjId, nil
+}
 
-			// reverse list insert
-			h.conjReverse2(conj)
-			return
+func (h *Handler) amtBuild(a *Assignment) (amtId int, err error) {
+	amt := &Amt{terms: make([]int, 0, len(a.Vals)), belong: a.Belong}
+	if a.NamedSet != "" {
+		// a reference is a single term, which is found by namedSetLookup with any value in the set
+		tid := h.terms.Add(&Term{key: a.Key, val: a.NamedSet, kind: namedSetTerm}, h)
+		h.namedSetIndexAdd(a.Key, a.NamedSet, tid)
+		amt.terms = append(amt.terms, tid)
+	}
+	if a.Exists {
+		// existence is a single term of key, which is found with any value of key
+		tid := h.terms.Add(&Term{key: a.Key, kind: existsTerm}, h)
+		amt.terms = append(amt.terms, tid)
+	}
+	if a.Bucket != nil {
+		// a bucket range is indexed as a single term, which is found by bucketLookup
+		fn := bucketFunc{mod: a.Bucket.Mod, salt: a.Bucket.Salt}
+		term := &Term{key: a.Key, val: fn.String() + " " + a.Range.canonical(NumberKey), kind: bucketTerm}
+		tid := h.terms.Add(term, h)
+		h.bucketIndexAdd(a.Key, a.Bucket, a.Range, tid)
+		amt.terms = append(amt.terms, tid)
+	} else if a.Range != nil {
+		// a range is indexed as a single term, which is found by rangeLookup
+		term := &Term{key: a.Key, val: a.Range.canonical(h.KeyType(a.Key)), kind: rangeTerm}
+		tid := h.terms.Add(term, h)
+		if err := h.rangeIndexAdd(a.Key, a.Range, tid); err != nil {
+			return -1, err
 		}
-
-		val, i = getString(dnf, i)
-		ASSERT(val == "and")
+		amt.terms = append(amt.terms, tid)
 	}
-}
-
-func (h *Handler) amtBuild(key string, vals []string, belong bool) (amtId int) {
-	amt := &Amt{terms: make([]int, 0), belong: belong}
-	for _, val := range vals {
-		term := &Term{key: key, val: val}
+	if a.Geo != nil {
+		// an area is indexed as a single term, which is found by geoLookup
+		term := &Term{key: a.Key, val: a.Geo.canonical(), kind: geoTerm}
 		tid := h.terms.Add(term, h)
+		h.geoIndexAdd(a.Key, a.Geo, tid)
 		amt.terms = append(amt.terms, tid)
 	}
-	return h.amts.Add(amt, h)
+	if a.Week != nil {
+		// windows are indexed as a single term, which is found by weekLookup at the time of search
+		term := &Term{key: a.Key, val: canonicalWeek(a.Week), kind: weekTerm}
+		tid := h.terms.Add(term, h)
+		h.weekIndexAdd(a.Week, tid)
+		amt.terms = append(amt.terms, tid)
+	}
+	for _, val := range a.Vals {
+		term := &Term{key: a.Key, val: val}
+		if a.Under {
+			// a path is found by underLookup with any of its descendants
+			term.val, term.kind = h.cleanPath(val), underTerm
+			h.underIndexAdd(a.Key)
+		}
+		var ipnet *net.IPNet
+		if a.CIDR {
+			// a prefix is found by cidrLookup with any ip in it
+			_, ipnet, _ = net.ParseCIDR(val)
+			term.val, term.kind = ipnet.String(), cidrTerm
+		}
+		tid := h.terms.Add(term, h)
+		if ipnet != nil {
+			h.cidrIndexAdd(a.Key, ipnet, tid)
+		}
+		amt.terms = append(amt.terms, tid)
+	}
+	return h.amts.Add(amt, h), nil
 }
 
 // Doc: (age ∈ { 3, 4 } and state ∈ { NY } ) or ( state ∈ { CA } and gender ∈ { M } ) -->
@@ -169,7 +236,11 @@ type Doc struct {
 	id         int     // unique id
 	docid      string  // sent by doc adder
 	name       string  // name of doc, for ad management
-	dnf        string  // dnf decription
+	dnf        string  // dnf decription in canonical syntax
+	expr       *Expr   // syntax tree of dnf
+	boolExpr   string  // original boolean expression, if added by AddBoolExpr
+	normalized string  // dnf with normalized values, if the handler has normalizers
+	simplified string  // simplified dnf which is indexed, if added with AddOptions.Simplify
 	conjSorted bool    // is conjs slice sorted
 	conjs      []int   // conjunction ids
 	attr       DocAttr // ad attr
@@ -192,6 +263,24 @@ func (doc *Doc) GetDnf() string {
 	return doc.dnf
 }
 
+// GetBoolExpr returns the original boolean expression of this doc,
+// or "" if this doc was not added by AddBoolExpr
+func (doc *Doc) GetBoolExpr() string {
+	return doc.boolExpr
+}
+
+// GetNormalizedDnf returns the dnf with values normalized by normalizers of handler,
+// or "" if the handler has no normalizers, see Handler.SetNormalizers
+func (doc *Doc) GetNormalizedDnf() string {
+	return doc.normalized
+}
+
+// GetSimplifiedDnf returns the simplified dnf which is indexed,
+// or "" if this doc was not added with AddOptions.Simplify
+func (doc *Doc) GetSimplifiedDnf() string {
+	return doc.simplified
+}
+
 // GetAttr returns attribute of this doc
 func (doc *Doc) GetAttr() DocAttr {
 	return doc.attr
@@ -266,19 +355,44 @@ func (a *Amt) Equal(amt *Amt) bool {
 // A Term like state ∉ { CA } reprensents the following value:
 // Term{id: xxx, key: state, val: CA, belong: false}
 type Term struct {
-	id  int
-	key string
-	val string
-}
+	id   int
+	key  string
+	val  string
+	kind termKind
+}
+
+// kind of term, terms of kinds other than valueTerm
+// are predicates which can not be found by key%val
+type termKind int
+
+const (
+	valueTerm termKind = iota // key%val
+	rangeTerm                 // numeric range, val is the interval like [18, 35)
+	underTerm                 // path prefix, val is the path like CN/SH
+	cidrTerm                  // ip prefix, val is the canonical cidr like 10.0.0.0/8
+	geoTerm                   // geo area, val is the area like {31.23, 121.47, 5000m}
+	bucketTerm                // range of bucket, val is like bucket(1000, "exp42") [0, 50)
+	existsTerm                // existence of key, val is empty
+	namedSetTerm              // reference to a named set, val is the name of set
+	weekTerm                  // weekly time windows, val is like {Mon-Fri 09:00-18:00 Asia/Shanghai}
+)
 
-// A term Equal iff key and val equal
+// A term Equal iff key, val and kind equal
 func (t *Term) Equal(term *Term) bool {
-	if t.key == term.key && t.val == term.val {
+	if t.key == term.key && t.val == term.val && t.kind == term.kind {
 		return true
 	}
 	return false
 }
 
+// mapKey returns the key of term in Handler.termMap
+func (t *Term) mapKey() string {
+	if t.kind == valueTerm {
+		return t.key + "%" + t.val
+	}
+	return t.key + "%\x00" + strconv.Itoa(int(t.kind)) + "%" + t.val
+}
+
 // post lists
 type docList struct {
 	locker *rwLockWrapper
@@ -383,7 +497,7 @@ func (al *amtList) Add(amt *Amt, h *Handler) (amtId int) {
 
 func (tl *termList) Add(term *Term, h *Handler) (termId int) {
 	h.termMapLock.RLock()
-	if tid, ok := h.termMap[term.key+"%"+term.val]; ok {
+	if tid, ok := h.termMap[term.mapKey()]; ok {
 		h.termMapLock.RUnlock()
 		term.id = tid
 		return term.id
@@ -396,7 +510,7 @@ func (tl *termList) Add(term *Term, h *Handler) (termId int) {
 	tl.Unlock()
 
 	h.termMapLock.Lock()
-	h.termMap[term.key+"%"+term.val] = term.id
+	h.termMap[term.mapKey()] = term.id
 	h.termMapLock.Unlock()
 	return term.id
 }
@@ -460,23 +574,27 @@ func (h *Handler) conjReverse1(docId int, conjIds []int) {
 */
 type cPair struct {
 	conjId int
+	amtId  int // -1 for ∅
 	belong bool
 }
 
+// pairs are sorted by conjId, ∈ before ∉, then amtId
+func (a cPair) less(b cPair) bool {
+	if a.conjId != b.conjId {
+		return a.conjId < b.conjId
+	}
+	if a.belong != b.belong {
+		return a.belong
+	}
+	return a.amtId < b.amtId
+}
+
 // for sort interface
 type cPairSlice []cPair
 
-func (p cPairSlice) Len() int { return len(p) }
-func (p cPairSlice) Less(i, j int) bool {
-	if p[i].conjId == p[j].conjId {
-		return p[i].belong
-	}
-	return p[i].conjId < p[j].conjId
-}
-func (p cPairSlice) Swap(i, j int) {
-	p[i].conjId, p[j].conjId = p[j].conjId, p[i].conjId
-	p[i].belong, p[j].belong = p[j].belong, p[i].belong
-}
+func (p cPairSlice) Len() int           { return len(p) }
+func (p cPairSlice) Less(i, j int) bool { return p[i].less(p[j]) }
+func (p cPairSlice) Swap(i, j int)      { p[i], p[j] = p[j], p[i] }
 
 type termRvs struct {
 	termId int
@@ -512,11 +630,20 @@ func (h *Handler) conjReverse2(conj *Conj) {
 	h.amts.RLock()
 	defer h.amts.RUnlock()
 
+	shares := make(map[int]int)
 	for _, amtId := range conj.amts {
 		termRvsList = h.insertTermRvsList(conj.id, amtId, termRvsList)
+		if !h.amts.amts[amtId].belong {
+			continue
+		}
+		for _, tid := range h.amts.amts[amtId].terms {
+			if shares[tid]++; shares[tid] > h.termShare {
+				h.termShare = shares[tid]
+			}
+		}
 	}
 	if conj.size == 0 {
-		termRvsList[0].cList = insertClist(conj.id, true, termRvsList[0].cList)
+		termRvsList[0].cList = insertClist(conj.id, -1, true, termRvsList[0].cList)
 	}
 }
 
@@ -549,12 +676,12 @@ func (h *Handler) insertTermRvsList(conjId int, amtId int, list []termRvs) []ter
 			if clist == nil {
 				clist = make([]cPair, 0)
 			}
-			clist = insertClist(conjId, amt.belong, clist)
+			clist = insertClist(conjId, amtId, amt.belong, clist)
 			list[idx].cList = clist
 		} else {
 			// term has not been found
 			clist := make([]cPair, 0, 1)
-			clist = append(clist, cPair{conjId: conjId, belong: amt.belong})
+			clist = append(clist, cPair{conjId: conjId, amtId: amtId, belong: amt.belong})
 			list = append(list, termRvs{termId: tid, cList: clist})
 			n := len(list)
 			if n > 1 && list[n-1].termId < list[n-2].termId {
@@ -566,18 +693,16 @@ func (h *Handler) insertTermRvsList(conjId int, amtId int, list []termRvs) []ter
 	return list
 }
 
-func insertClist(conjId int, belong bool, l []cPair) []cPair {
-	idx := sort.Search(len(l), func(i int) bool {
-		if l[i].conjId == conjId {
-			return !l[i].belong || l[i].belong == belong
-		}
-		return l[i].conjId >= conjId
-	})
-	if idx < len(l) && (l[idx].conjId == conjId && l[idx].belong == belong) {
+// two assignments of a conjunction may share a term, like k under {CN} and k under {CN, US},
+// so a pair is found only if its amtId equals too
+func insertClist(conjId, amtId int, belong bool, l []cPair) []cPair {
+	pair := cPair{conjId: conjId, amtId: amtId, belong: belong}
+	idx := sort.Search(len(l), func(i int) bool { return !l[i].less(pair) })
+	if idx < len(l) && l[idx] == pair {
 		// found
 		return l
 	}
-	l = append(l, cPair{conjId: conjId, belong: belong})
+	l = append(l, pair)
 	n := len(l)
 	if n > 1 && !cPairSlice(l).Less(n-2, n-1) {
 		sort.Sort(cPairSlice(l))
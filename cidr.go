@@ -0,0 +1,85 @@
+package godnf
+
+import "net"
+
+// cidrNode is a node of the binary trie of ip prefixes,
+// termIds are the cidr terms whose prefix ends at this node
+type cidrNode struct {
+	children [2]*cidrNode
+	termIds  []int
+}
+
+// cidrIndex indexes ip prefixes of a key, IPv4 and IPv6 in separate tries,
+// a lookup walks the bits of an ip and collects every prefix on the way
+type cidrIndex struct {
+	v4, v6 cidrNode
+}
+
+func (idx *cidrIndex) add(ipnet *net.IPNet, termId int) {
+	// the family of a prefix is decided by its mask, ::ffff:0:0/96 is an IPv6 prefix
+	node, ip := &idx.v6, ipnet.IP.To16()
+	if len(ipnet.Mask) == net.IPv4len {
+		node, ip = &idx.v4, ipnet.IP.To4()
+	}
+	ones, _ := ipnet.Mask.Size()
+	for i := 0; i < ones; i++ {
+		bit := ip[i/8] >> uint(7-i%8) & 1
+		if node.children[bit] == nil {
+			node.children[bit] = &cidrNode{}
+		}
+		node = node.children[bit]
+	}
+	for _, id := range node.termIds {
+		if id == termId {
+			return
+		}
+	}
+	node.termIds = append(node.termIds, termId)
+}
+
+// lookup appends ids of terms whose prefix contains ip to ids
+func (idx *cidrIndex) lookup(ip net.IP, ids []int) []int {
+	node := &idx.v6
+	if ip4 := ip.To4(); ip4 != nil {
+		node, ip = &idx.v4, ip4
+	}
+	for i := 0; node != nil; i++ {
+		ids = append(ids, node.termIds...)
+		if i == len(ip)*8 {
+			break
+		}
+		node = node.children[ip[i/8]>>uint(7-i%8)&1]
+	}
+	return ids
+}
+
+// cidrIndexAdd indexes cidr term of key
+func (h *Handler) cidrIndexAdd(key string, ipnet *net.IPNet, termId int) {
+	h.cidrsLock.Lock()
+	defer h.cidrsLock.Unlock()
+	idx, ok := h.cidrs[key]
+	if !ok {
+		idx = &cidrIndex{}
+		h.cidrs[key] = idx
+	}
+	idx.add(ipnet, termId)
+}
+
+// cidrLookup appends ids of cidr terms matched by conds to termids
+func (h *Handler) cidrLookup(conds []Cond, termids []int) []int {
+	h.cidrsLock.RLock()
+	defer h.cidrsLock.RUnlock()
+	if len(h.cidrs) == 0 {
+		return termids
+	}
+	for i := range conds {
+		idx, ok := h.cidrs[conds[i].Key]
+		if !ok {
+			continue
+		}
+		if ip := net.ParseIP(conds[i].Val); ip != nil {
+			termids = idx.lookup(ip, termids)
+		}
+	}
+	return termids
+}
@@ -0,0 +1,90 @@
+package godnf_test
+
+import (
+	"testing"
+
+	dnf "github.com/brg-liuwei/godnf"
+)
+
+func TestParseCIDR(t *testing.T) {
+	setDelim()
+	s := "(ip in cidr {10.0.0.0/8, 2001:db8::/32} and region not in cidr {192.168.1.0/24})"
+	if got, err := dnf.FormatDNF(s); err != nil {
+		t.Error("unexpected error when FormatDNF: ", err)
+	} else if got != "(ip in cidr {10.0.0.0/8, 2001:db8::/32} and region not in cidr {192.168.1.0/24})" {
+		t.Error("unexpected dnf: ", got)
+	}
+
+	b, err := dnf.DNFToJSON("(ip not in cidr {10.0.0.0/8})")
+	if err != nil {
+		t.Fatal("unexpected error when DNFToJSON: ", err)
+	}
+	if string(b) != `{"or":[{"and":[{"key":"ip","not_in_cidr":["10.0.0.0/8"]}]}]}` {
+		t.Error("unexpected json: ", string(b))
+	}
+	if _, err := dnf.JSONToDNF([]byte(`{"or":[{"and":[{"key":"ip","in_cidr":["10.0.0.0"]}]}]}`)); err == nil {
+		t.Error("expect error when JSONToDNF an invalid cidr")
+	}
+
+	for _, s := range []string{
+		"(ip in cidr {10.0.0.0})",
+		"(ip in cidr {10.0.0.0/33})",
+		"(ip in cidrs {10.0.0.0/8})",
+		"(ip under cidr {10.0.0.0/8})",
+	} {
+		if err := dnf.DnfCheck(s); err == nil {
+			t.Error("expect error when DnfCheck: ", s)
+		}
+	}
+}
+
+func TestCIDRRetrieval(t *testing.T) {
+	h := dnf.NewHandlerWithoutLock()
+	for i, s := range []string{
+		"(ip in cidr {10.0.0.0/8, 2001:db8::/32})",               // docid: 0
+		"(ip in cidr {10.1.0.0/16})",                             // docid: 1
+		"(ip not in cidr {10.1.2.0/24} and region in {SH})",      // docid: 2
+		"(ip in cidr {0.0.0.0/0} and ip2 in cidr {10.1.2.3/32})", // docid: 3
+	} {
+		if err := h.AddDoc("doc", string(rune('0'+i)), s, attr{i, "doc"}); err != nil {
+			t.Fatal("unexpected error when AddDoc: ", err)
+		}
+	}
+
+	for _, c := range []struct {
+		conds    []dnf.Cond
+		expected []int
+	}{
+		{[]dnf.Cond{{"ip", "10.1.2.3"}}, []int{0, 1}},
+		{[]dnf.Cond{{"ip", "10.1.2.3"}, {"region", "SH"}}, []int{0, 1}},
+		{[]dnf.Cond{{"ip", "10.1.3.3"}, {"region", "SH"}}, []int{0, 1, 2}},
+		{[]dnf.Cond{{"ip", "10.2.3.4"}}, []int{0}},
+		{[]dnf.Cond{{"ip", "11.2.3.4"}, {"ip2", "10.1.2.3"}}, []int{3}},
+		{[]dnf.Cond{{"ip", "2001:db8:1::1"}, {"region", "SH"}}, []int{0, 2}},
+		{[]dnf.Cond{{"ip", "2001:db9::1"}}, []int{}},
+		{[]dnf.Cond{{"ip", "::ffff:10.1.2.3"}}, []int{0, 1}},
+		{[]dnf.Cond{{"ip", "not an ip"}, {"region", "SH"}}, []int{2}},
+	} {
+		docs, err := h.SearchAll(c.conds)
+		if err != nil {
+			t.Fatal("unexpected error when Search: ", err)
+		}
+		if !sameDocs(h, docs, c.expected) {
+			t.Errorf("unexpected docs of %v: %v, expect %v", c.conds, docs, c.expected)
+		}
+	}
+}
+
+func TestCIDRCountedOnce(t *testing.T) {
+	h := dnf.NewHandlerWithoutLock()
+	// an ip in several prefixes of an assignment counts once
+	if err := h.AddDoc("doc", "0", "(ip in cidr {10.0.0.0/8, 10.1.0.0/16} and os in {ios})", attr{0, "doc"}); err != nil {
+		t.Fatal("unexpected error when AddDoc: ", err)
+	}
+	if docs, _ := h.SearchAll([]dnf.Cond{{"ip", "10.1.2.3"}}); len(docs) != 0 {
+		t.Error("expect no docs without os, got ", docs)
+	}
+	if docs, _ := h.SearchAll([]dnf.Cond{{"ip", "10.1.2.3"}, {"os", "ios"}}); !sameDocs(h, docs, []int{0}) {
+		t.Error("unexpected docs with os: ", docs)
+	}
+}
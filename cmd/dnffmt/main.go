@@ -0,0 +1,166 @@
+// Dnffmt formats dnf files like gofmt.
+//
+// A dnf file contains one dnf per line, blank lines and lines starting with '#' are kept as is.
+// Without an explicit path, it processes the standard input.
+//
+// Usage:
+//
+//	dnffmt [flags] [path ...]
+//
+// The flags are:
+//
+//	-d
+//		Do not print reformatted sources to standard output.
+//		If a file's formatting is different than dnffmt's, print diffs
+//		to standard output.
+//	-l
+//		Do not print reformatted sources to standard output.
+//		If a file's formatting is different from dnffmt's, print its name
+//		to standard output.
+//	-w
+//		Do not print reformatted sources to standard output.
+//		If a file's formatting is different from dnffmt's, overwrite it
+//		with dnffmt's version.
+package main
+
+import (
+	"bytes"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"strings"
+
+	dnf "github.com/brg-liuwei/godnf"
+)
+
+// options of a run of dnffmt
+type options struct {
+	list, write, diff bool
+}
+
+func main() {
+	os.Exit(run(os.Args[1:], os.Stdin, os.Stdout, os.Stderr))
+}
+
+// run runs dnffmt with args and returns the exit code
+func run(args []string, stdin io.Reader, stdout, stderr io.Writer) int {
+	var opts options
+	flags := flag.NewFlagSet("dnffmt", flag.ContinueOnError)
+	flags.SetOutput(stderr)
+	flags.BoolVar(&opts.list, "l", false, "list files whose formatting differs from dnffmt's")
+	flags.BoolVar(&opts.write, "w", false, "write result to (source) file instead of stdout")
+	flags.BoolVar(&opts.diff, "d", false, "display diffs instead of rewriting files")
+	flags.Usage = func() {
+		fmt.Fprintf(stderr, "usage: dnffmt [flags] [path ...]\n")
+		flags.PrintDefaults()
+	}
+	if err := flags.Parse(args); err != nil {
+		return 2
+	}
+
+	if flags.NArg() == 0 {
+		if opts.write {
+			fmt.Fprintln(stderr, "error: cannot use -w with standard input")
+			return 2
+		}
+		if err := opts.processFile("<standard input>", stdin, stdout); err != nil {
+			fmt.Fprintln(stderr, err)
+			return 2
+		}
+		return 0
+	}
+
+	exitCode := 0
+	for _, path := range flags.Args() {
+		if err := opts.processFile(path, nil, stdout); err != nil {
+			fmt.Fprintln(stderr, err)
+			exitCode = 2
+		}
+	}
+	return exitCode
+}
+
+// processFile formats the file of filename, or in if in is not nil
+func (opts *options) processFile(filename string, in io.Reader, out io.Writer) error {
+	var src []byte
+	var err error
+	if in == nil {
+		src, err = ioutil.ReadFile(filename)
+	} else {
+		src, err = ioutil.ReadAll(in)
+	}
+	if err != nil {
+		return err
+	}
+
+	res, err := format(filename, src)
+	if err != nil {
+		return err
+	}
+
+	if bytes.Equal(src, res) {
+		if !opts.list && !opts.write && !opts.diff {
+			_, err = out.Write(res)
+		}
+		return err
+	}
+
+	if opts.list {
+		fmt.Fprintln(out, filename)
+	}
+	if opts.write {
+		info, err := os.Stat(filename)
+		if err != nil {
+			return err
+		}
+		if err = ioutil.WriteFile(filename, res, info.Mode().Perm()); err != nil {
+			return err
+		}
+	}
+	if opts.diff {
+		fmt.Fprint(out, lineDiff(filename, src, res))
+	}
+	if !opts.list && !opts.write && !opts.diff {
+		_, err = out.Write(res)
+	}
+	return err
+}
+
+// format formats each dnf line of src
+func format(filename string, src []byte) ([]byte, error) {
+	lines := strings.Split(string(src), "\n")
+	for i, line := range lines {
+		text := strings.TrimRight(line, "\r")
+		trimmed := strings.TrimSpace(text)
+		if trimmed == "" || strings.HasPrefix(trimmed, "#") {
+			continue
+		}
+		formatted, err := dnf.FormatDNF(text)
+		if err != nil {
+			var perr *dnf.ParseError
+			if errors.As(err, &perr) {
+				return nil, fmt.Errorf("%s:%d:%d: %s\n%s", filename, i+1, perr.Column, perr.Message(), perr.Snippet)
+			}
+			return nil, fmt.Errorf("%s:%d: %s", filename, i+1, err)
+		}
+		lines[i] = formatted + line[len(text):]
+	}
+	return []byte(strings.Join(lines, "\n")), nil
+}
+
+// lineDiff shows changed lines, dnffmt never adds or removes lines
+func lineDiff(filename string, src, res []byte) string {
+	var buf bytes.Buffer
+	fmt.Fprintf(&buf, "--- %s.orig\n+++ %s\n", filename, filename)
+	srcLines := strings.Split(string(src), "\n")
+	resLines := strings.Split(string(res), "\n")
+	for i := range srcLines {
+		if srcLines[i] != resLines[i] {
+			fmt.Fprintf(&buf, "@@ -%d +%d @@\n-%s\n+%s\n", i+1, i+1, srcLines[i], resLines[i])
+		}
+	}
+	return buf.String()
+}
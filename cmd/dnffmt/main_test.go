@@ -0,0 +1,93 @@
+package main
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+const (
+	unformatted = "# campaigns\n( region in {SH,BJ}  and age not in {3})\n\n(gender in {male})\n"
+	formatted   = "# campaigns\n(age not in {3} and region in {BJ, SH})\n\n(gender in {male})\n"
+)
+
+// tempFile writes src to a file in dir and returns its path
+func tempFile(t *testing.T, dir, name, src string) string {
+	path := filepath.Join(dir, name)
+	if err := ioutil.WriteFile(path, []byte(src), 0644); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func runDnffmt(stdin string, args ...string) (code int, stdout, stderr string) {
+	var out, errOut bytes.Buffer
+	code = run(args, strings.NewReader(stdin), &out, &errOut)
+	return code, out.String(), errOut.String()
+}
+
+func TestStdin(t *testing.T) {
+	code, out, errOut := runDnffmt(unformatted)
+	if code != 0 || out != formatted || errOut != "" {
+		t.Errorf("format stdin: code %d, stdout %q, stderr %q", code, out, errOut)
+	}
+
+	if code, _, errOut := runDnffmt(unformatted, "-w"); code != 2 || errOut == "" {
+		t.Errorf("expect error when -w with stdin, code %d, stderr %q", code, errOut)
+	}
+}
+
+func TestFlags(t *testing.T) {
+	dir, err := ioutil.TempDir("", "dnffmt")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	bad := tempFile(t, dir, "bad.dnf", unformatted)
+	good := tempFile(t, dir, "good.dnf", formatted)
+
+	code, out, _ := runDnffmt("", "-l", bad, good)
+	if code != 0 || out != bad+"\n" {
+		t.Errorf("-l: code %d, stdout %q", code, out)
+	}
+
+	code, out, _ = runDnffmt("", "-d", bad, good)
+	expected := "--- " + bad + ".orig\n+++ " + bad + "\n@@ -2 +2 @@\n" +
+		"-( region in {SH,BJ}  and age not in {3})\n+(age not in {3} and region in {BJ, SH})\n"
+	if code != 0 || out != expected {
+		t.Errorf("-d: code %d\n  got:    %q\n  expect: %q", code, out, expected)
+	}
+
+	// -l and -d do not touch files
+	if src, _ := ioutil.ReadFile(bad); string(src) != unformatted {
+		t.Errorf("file is changed without -w: %q", src)
+	}
+
+	code, out, _ = runDnffmt("", "-w", bad, good)
+	if code != 0 || out != "" {
+		t.Errorf("-w: code %d, stdout %q", code, out)
+	}
+	for _, path := range []string{bad, good} {
+		if src, _ := ioutil.ReadFile(path); string(src) != formatted {
+			t.Errorf("%s after -w: %q", path, src)
+		}
+	}
+}
+
+func TestParseError(t *testing.T) {
+	dir, err := ioutil.TempDir("", "dnffmt")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	path := tempFile(t, dir, "err.dnf", "(gender in {male})\n(region in {SH}\n")
+
+	code, out, errOut := runDnffmt("", "-l", path)
+	expected := path + `:2:16: found "EOF", expected "and" or "&&" or ")"` + "\n(region in {SH}\n               ^\n"
+	if code != 2 || out != "" || errOut != expected {
+		t.Errorf("parse error: code %d, stdout %q\n  got:    %q\n  expect: %q", code, out, errOut, expected)
+	}
+}
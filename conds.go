@@ -0,0 +1,192 @@
+package godnf
+
+import (
+	"errors"
+	"fmt"
+	"net/url"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// CondsFromStruct returns conds of fields of struct v (or a pointer to it) with dnf tags:
+//
+//	type Request struct {
+//		Region    string   `dnf:"region"`
+//		Age       int      `dnf:"age"`
+//		Interests []string `dnf:"interest"` // a cond of each interest
+//		OS        *string  `dnf:"os"`       // no cond if nil
+//		City      string   `dnf:"city,omitempty"` // no cond if ""
+//		UserId    string   `dnf:"-"`
+//	}
+//
+// fields without dnf tags are ignored except embedded structs, whose fields are flattened.
+// A tag is the key optionally followed by options like encoding/json, omitempty is the only
+// option, which omits the field if it is the zero value.
+// Strings, numbers, bools and fmt.Stringers are values, slices and arrays are several values,
+// and nil pointers, interfaces and slices are no values. Keys are used as is, and values are
+// normalized by Search with normalizers of handler like values of docs
+func CondsFromStruct(v interface{}) ([]Cond, error) {
+	rv := reflect.ValueOf(v)
+	for rv.Kind() == reflect.Ptr && !rv.IsNil() {
+		rv = rv.Elem()
+	}
+	if rv.Kind() != reflect.Struct {
+		return nil, errors.New("conds from " + fmt.Sprintf("%T", v) + ": expect a struct")
+	}
+	return structConds(nil, rv)
+}
+
+func structConds(conds []Cond, rv reflect.Value) ([]Cond, error) {
+	t := rv.Type()
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		tag, tagged := f.Tag.Lookup("dnf")
+		if tag == "-" {
+			continue
+		}
+		fv := rv.Field(i)
+		if f.Anonymous && !tagged {
+			for fv.Kind() == reflect.Ptr && !fv.IsNil() {
+				fv = fv.Elem()
+			}
+			if fv.Kind() != reflect.Struct {
+				continue
+			}
+			var err error
+			if conds, err = structConds(conds, fv); err != nil {
+				return nil, err
+			}
+			continue
+		}
+		if !tagged || f.PkgPath != "" {
+			continue
+		}
+		key, opts := tag, ""
+		if i := strings.IndexByte(tag, ','); i >= 0 {
+			key, opts = tag[:i], tag[i+1:]
+		}
+		if key == "" {
+			return nil, errors.New("empty key of field " + f.Name)
+		}
+		omitEmpty := false
+		for _, opt := range strings.Split(opts, ",") {
+			switch opt {
+			case "":
+			case "omitempty":
+				omitEmpty = true
+			default:
+				return nil, errors.New("unknown option " + opt + " of field " + f.Name)
+			}
+		}
+		if omitEmpty && fv.IsZero() {
+			continue
+		}
+		var err error
+		if conds, err = appendConds(conds, key, fv, false); err != nil {
+			return nil, err
+		}
+	}
+	return conds, nil
+}
+
+// CondsFromMap returns conds of m sorted by key, values are converted like CondsFromStruct
+func CondsFromMap(m map[string]interface{}) ([]Cond, error) {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	var conds []Cond
+	for _, key := range keys {
+		if key == "" {
+			return nil, errors.New("empty key in map")
+		}
+		var err error
+		if conds, err = appendConds(conds, key, reflect.ValueOf(m[key]), false); err != nil {
+			return nil, err
+		}
+	}
+	return conds, nil
+}
+
+// CondsFromValues returns conds of query parameters sorted by key, each value is a cond:
+//
+//	region=SH&interest=sports&interest=music --> [{interest sports} {interest music} {region SH}]
+func CondsFromValues(values url.Values) ([]Cond, error) {
+	keys := make([]string, 0, len(values))
+	for k := range values {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	var conds []Cond
+	for _, key := range keys {
+		if key == "" {
+			return nil, errors.New("empty key in values")
+		}
+		for _, val := range values[key] {
+			conds = append(conds, Cond{Key: key, Val: val})
+		}
+	}
+	return conds, nil
+}
+
+var stringerType = reflect.TypeOf((*fmt.Stringer)(nil)).Elem()
+
+// appendConds appends conds of key with values of v, elem is true if v is an elem of slice
+func appendConds(conds []Cond, key string, v reflect.Value, elem bool) ([]Cond, error) {
+	if !v.IsValid() {
+		return conds, nil
+	}
+	switch v.Kind() {
+	case reflect.Ptr, reflect.Interface, reflect.Slice:
+		if v.IsNil() {
+			return conds, nil
+		}
+	}
+	if v.Type().Implements(stringerType) && v.CanInterface() {
+		return append(conds, Cond{Key: key, Val: v.Interface().(fmt.Stringer).String()}), nil
+	}
+
+	var val string
+	switch v.Kind() {
+	case reflect.Ptr, reflect.Interface:
+		return appendConds(conds, key, v.Elem(), elem)
+	case reflect.String:
+		val = v.String()
+	case reflect.Bool:
+		val = strconv.FormatBool(v.Bool())
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		val = strconv.FormatInt(v.Int(), 10)
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		val = strconv.FormatUint(v.Uint(), 10)
+	case reflect.Float32:
+		val = strconv.FormatFloat(v.Float(), 'g', -1, 32)
+	case reflect.Float64:
+		val = strconv.FormatFloat(v.Float(), 'g', -1, 64)
+	case reflect.Slice, reflect.Array:
+		if v.Type().Elem().Kind() == reflect.Uint8 {
+			// bytes are a string
+			b := make([]byte, v.Len())
+			reflect.Copy(reflect.ValueOf(b), v)
+			val = string(b)
+			break
+		}
+		if elem {
+			return nil, errors.New("value of key " + key + " is a nested " + v.Type().String())
+		}
+		for i := 0; i < v.Len(); i++ {
+			var err error
+			if conds, err = appendConds(conds, key, v.Index(i), true); err != nil {
+				return nil, err
+			}
+		}
+		return conds, nil
+	default:
+		return nil, errors.New("value of key " + key + " is an unsupported " + v.Type().String())
+	}
+	return append(conds, Cond{Key: key, Val: val}), nil
+}
@@ -0,0 +1,145 @@
+package godnf_test
+
+import (
+	"net"
+	"net/url"
+	"reflect"
+	"testing"
+
+	dnf "github.com/brg-liuwei/godnf"
+)
+
+type condsDevice struct {
+	OS      string `dnf:"os"`
+	Version *string
+}
+
+type condsRequest struct {
+	condsDevice
+	Region    string   `dnf:"region"`
+	Age       int      `dnf:"age"`
+	Score     float64  `dnf:"score"`
+	VIP       bool     `dnf:"vip"`
+	Interests []string `dnf:"interest"`
+	City      *string  `dnf:"city"`
+	IP        net.IP   `dnf:"ip"`
+	Channel   string   `dnf:"channel,omitempty"`
+	UserId    string   `dnf:"-"`
+	Name      string
+	secret    string `dnf:"secret"`
+}
+
+func TestCondsFromStruct(t *testing.T) {
+	city := "SH"
+	req := &condsRequest{
+		condsDevice: condsDevice{OS: "ios"},
+		Region:      "CN",
+		Age:         18,
+		Score:       0.5,
+		Interests:   []string{"sports", "music"},
+		City:        &city,
+		IP:          net.ParseIP("10.0.0.1"),
+		Channel:     "app",
+		UserId:      "u1",
+		Name:        "n",
+		secret:      "s",
+	}
+	conds, err := dnf.CondsFromStruct(req)
+	if err != nil {
+		t.Fatal("unexpected error when CondsFromStruct: ", err)
+	}
+	expected := []dnf.Cond{{"os", "ios"}, {"region", "CN"}, {"age", "18"}, {"score", "0.5"}, {"vip", "false"},
+		{"interest", "sports"}, {"interest", "music"}, {"city", "SH"}, {"ip", "10.0.0.1"}, {"channel", "app"}}
+	if !reflect.DeepEqual(conds, expected) {
+		t.Errorf("unexpected conds: %v, expect %v", conds, expected)
+	}
+
+	req.City, req.Interests, req.IP, req.Channel = nil, nil, nil, ""
+	conds, _ = dnf.CondsFromStruct(*req)
+	expected = []dnf.Cond{{"os", "ios"}, {"region", "CN"}, {"age", "18"}, {"score", "0.5"}, {"vip", "false"}}
+	if !reflect.DeepEqual(conds, expected) {
+		t.Errorf("unexpected conds without optional fields: %v, expect %v", conds, expected)
+	}
+
+	for _, v := range []interface{}{
+		nil,
+		"region",
+		(*condsRequest)(nil),
+		struct {
+			M map[string]int `dnf:"m"`
+		}{map[string]int{}},
+		struct {
+			S [][]string `dnf:"s"`
+		}{[][]string{{"a"}}},
+		struct {
+			S string `dnf:""`
+		}{"a"},
+		struct {
+			S string `dnf:",omitempty"`
+		}{"a"},
+		struct {
+			S string `dnf:"s,required"`
+		}{"a"},
+	} {
+		if _, err := dnf.CondsFromStruct(v); err == nil {
+			t.Errorf("expect error when CondsFromStruct %#v", v)
+		}
+	}
+}
+
+func TestCondsFromMap(t *testing.T) {
+	conds, err := dnf.CondsFromMap(map[string]interface{}{
+		"region":   "SH",
+		"age":      uint8(18),
+		"interest": []interface{}{"sports", 3},
+		"city":     nil,
+		"os":       (*string)(nil),
+		" os ":     "ios", // keys are not trimmed
+	})
+	if err != nil {
+		t.Fatal("unexpected error when CondsFromMap: ", err)
+	}
+	expected := []dnf.Cond{{" os ", "ios"}, {"age", "18"}, {"interest", "sports"}, {"interest", "3"}, {"region", "SH"}}
+	if !reflect.DeepEqual(conds, expected) {
+		t.Errorf("unexpected conds: %v, expect %v", conds, expected)
+	}
+
+	for _, m := range []map[string]interface{}{
+		{"region": struct{}{}},
+		{"interest": []interface{}{[]string{"a"}}},
+		{"": "a"},
+	} {
+		if _, err := dnf.CondsFromMap(m); err == nil {
+			t.Errorf("expect error when CondsFromMap %v", m)
+		}
+	}
+}
+
+func TestCondsFromValues(t *testing.T) {
+	values, _ := url.ParseQuery("region=SH&interest=sports&interest=music")
+	conds, err := dnf.CondsFromValues(values)
+	if err != nil {
+		t.Fatal("unexpected error when CondsFromValues: ", err)
+	}
+	expected := []dnf.Cond{{"interest", "sports"}, {"interest", "music"}, {"region", "SH"}}
+	if !reflect.DeepEqual(conds, expected) {
+		t.Errorf("unexpected conds: %v, expect %v", conds, expected)
+	}
+	if _, err := dnf.CondsFromValues(url.Values{"": {"a"}}); err == nil {
+		t.Error("expect error when CondsFromValues with an empty key")
+	}
+
+	setDelim()
+	h := dnf.NewHandler()
+	h.SetNormalizers("region", dnf.Lowercase)
+	if err := h.AddDoc("doc", "0", "(region in {sh} and interest in {music})", attr{0, "doc"}); err != nil {
+		t.Fatal("unexpected error when AddDoc: ", err)
+	}
+	docs, err := h.SearchAll(conds)
+	if err != nil {
+		t.Fatal("unexpected error when Search: ", err)
+	}
+	if !sameDocs(h, docs, []int{0}) {
+		t.Errorf("unexpected docs of %v: %v", conds, docs)
+	}
+}
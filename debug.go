@@ -57,11 +57,26 @@ func init() {
 
 // Term to string
 func (term *Term) ToString() string {
+	return term.toString(DefaultSyntax())
+}
+
+func (term *Term) toString(syntax Syntax) string {
 	if term.id == 0 {
 		// empty set
 		return "∅"
 	}
-	return fmt.Sprintf("( %s  %s )", term.key, term.val)
+	return fmt.Sprintf("( %s  %s )", syntax.quote(term.key), term.valString(syntax))
+}
+
+// valString returns val of a value, path or cidr term quoted, or the predicate of other terms as is
+func (term *Term) valString(syntax Syntax) string {
+	switch term.kind {
+	case valueTerm, underTerm, cidrTerm:
+		return syntax.quote(term.val)
+	case namedSetTerm:
+		return "@" + syntax.quote(term.val)
+	}
+	return term.val
 }
 
 // Amt to string
@@ -81,9 +96,26 @@ func (amt *Amt) ToString(h *Handler) string {
 		op = "∉"
 	}
 	key = h.terms.terms[amt.terms[0]].key
-	s := fmt.Sprintf("%s %s { ", key, op)
+	switch term := &h.terms.terms[amt.terms[0]]; term.kind {
+	case existsTerm:
+		if amt.belong {
+			return "has " + h.syntax.quote(key)
+		}
+		return "missing " + h.syntax.quote(key)
+	case rangeTerm, bucketTerm, namedSetTerm:
+		return fmt.Sprintf("%s %s %s", h.syntax.quote(key), op, term.valString(h.syntax))
+	case geoTerm:
+		return fmt.Sprintf("%s %s within %s", h.syntax.quote(key), op, term.valString(h.syntax))
+	case weekTerm:
+		return fmt.Sprintf("%s %s week %s", h.syntax.quote(key), op, term.valString(h.syntax))
+	case underTerm:
+		op += " under"
+	case cidrTerm:
+		op += " cidr"
+	}
+	s := fmt.Sprintf("%s %s { ", h.syntax.quote(key), op)
 	for i, idx := range amt.terms {
-		s += h.terms.terms[idx].val
+		s += h.syntax.quote(h.terms.terms[idx].val)
 		if i+1 < len(amt.terms) {
 			s += ", "
 		}
@@ -126,6 +158,61 @@ func (doc *Doc) ToString(h *Handler) (s string) {
 	return
 }
 
+// Assignment to string, keys and vals are quoted with the default syntax
+func (amt *Assignment) ToString() string {
+	syntax := DefaultSyntax()
+	op := "∈"
+	if !amt.Belong {
+		op = "∉"
+	}
+	if amt.Exists {
+		return DefaultSyntax().printAmt(amt)
+	}
+	if amt.Bucket != nil {
+		return fmt.Sprintf("%s %s %s", amt.Bucket.String(amt.Key), op, amt.Range.String())
+	}
+	if amt.Range != nil {
+		return fmt.Sprintf("%s %s %s", syntax.quote(amt.Key), op, amt.Range.String())
+	}
+	if amt.Geo != nil {
+		return fmt.Sprintf("%s %s within %s", syntax.quote(amt.Key), op, amt.Geo.String())
+	}
+	if amt.Week != nil {
+		return fmt.Sprintf("%s %s %s", syntax.quote(amt.Key), op, syntax.printWeek(amt.Week))
+	}
+	if amt.NamedSet != "" {
+		return fmt.Sprintf("%s %s @%s", syntax.quote(amt.Key), op, syntax.quote(amt.NamedSet))
+	}
+	if amt.Under {
+		op += " under"
+	} else if amt.CIDR {
+		op += " cidr"
+	}
+	vals := make([]string, 0, len(amt.Vals))
+	for _, val := range amt.Vals {
+		vals = append(vals, syntax.quote(val))
+	}
+	return fmt.Sprintf("%s %s { %s }", syntax.quote(amt.Key), op, strings.Join(vals, ", "))
+}
+
+// Conjunction to string
+func (conj *Conjunction) ToString() string {
+	ss := make([]string, 0, len(conj.Amts))
+	for _, amt := range conj.Amts {
+		ss = append(ss, amt.ToString())
+	}
+	return "( " + strings.Join(ss, " ∩ ") + " )"
+}
+
+// Expr to string
+func (expr *Expr) ToString() string {
+	ss := make([]string, 0, len(expr.Conjs))
+	for _, conj := range expr.Conjs {
+		ss = append(ss, conj.ToString())
+	}
+	return strings.Join(ss, " ∪ ")
+}
+
 func (dl *docList) display() {
 	dl.RLock()
 	defer dl.RUnlock()
@@ -169,6 +256,23 @@ func (h *Handler) DocId2Map(docid int) map[string]interface{} {
 	return h.docs.docId2Map(docid)
 }
 
+// dumpMap returns fields of doc dumped by Dump functions
+func (doc *Doc) dumpMap() map[string]interface{} {
+	return map[string]interface{}{
+		"id":             doc.id,
+		"name":           doc.name,
+		"docid":          doc.docid,
+		"active":         doc.active,
+		"comment":        doc.comment,
+		"dnf":            doc.dnf,
+		"dnf_json":       doc.expr,
+		"bool_expr":      doc.boolExpr,
+		"normalized_dnf": doc.normalized,
+		"simplified_dnf": doc.simplified,
+		"attr":           doc.attr.ToMap(),
+	}
+}
+
 // DumpByPage: dump all docs by page_num and page_size for debug
 func (h *Handler) DumpByPage(pageNum, pageSize int, filter func(DocAttr) bool) []byte {
 	h.docs.RLock()
@@ -202,14 +306,7 @@ func (h *Handler) DumpByPage(pageNum, pageSize int, filter func(DocAttr) bool) [
 	s := make([]interface{}, 0, len(h.docs.docs[start:end]))
 	for _, doc := range h.docs.docs[start:end] {
 		if filter(doc.attr) {
-			s = append(s, map[string]interface{}{
-				"name":    doc.name,
-				"docid":   doc.docid,
-				"active":  doc.active,
-				"comment": doc.comment,
-				"dnf":     doc.dnf,
-				"attr":    doc.attr.ToMap(),
-			})
+			s = append(s, doc.dumpMap())
 		}
 	}
 
@@ -228,14 +325,7 @@ func (h *Handler) DumpByFilter(filter func(DocAttr) bool) []byte {
 	var s []interface{}
 	for _, doc := range h.docs.docs {
 		if filter(doc.attr) {
-			s = append(s, map[string]interface{}{
-				"name":    doc.name,
-				"docid":   doc.docid,
-				"active":  doc.active,
-				"comment": doc.comment,
-				"dnf":     doc.dnf,
-				"attr":    doc.attr.ToMap(),
-			})
+			s = append(s, doc.dumpMap())
 		}
 	}
 	b, _ := json.Marshal(map[string]interface{}{
@@ -252,14 +342,7 @@ func (h *Handler) DumpById() []byte {
 
 	var s []interface{}
 	for _, doc := range h.docs.docs {
-		s = append(s, map[string]interface{}{
-			"name":    doc.name,
-			"docid":   doc.docid,
-			"active":  doc.active,
-			"comment": doc.comment,
-			"dnf":     doc.dnf,
-			"attr":    doc.attr.ToMap(),
-		})
+		s = append(s, doc.dumpMap())
 	}
 	b, _ := json.Marshal(s)
 	return b
@@ -272,14 +355,7 @@ func (h *Handler) DumpByDocId() []byte {
 
 	m := make(map[string]interface{})
 	for _, doc := range h.docs.docs {
-		m[doc.docid] = map[string]interface{}{
-			"id":      doc.id,
-			"name":    doc.name,
-			"active":  doc.active,
-			"comment": doc.comment,
-			"dnf":     doc.dnf,
-			"attr":    doc.attr.ToMap(),
-		}
+		m[doc.docid] = doc.dumpMap()
 	}
 	b, _ := json.Marshal(m)
 	return b
@@ -292,14 +368,7 @@ func (h *Handler) DumpByName() []byte {
 
 	m := make(map[string]interface{})
 	for _, doc := range h.docs.docs {
-		m[doc.name] = map[string]interface{}{
-			"id":      doc.id,
-			"docid":   doc.docid,
-			"active":  doc.active,
-			"comment": doc.comment,
-			"dnf":     doc.dnf,
-			"attr":    doc.attr.ToMap(),
-		}
+		m[doc.name] = doc.dumpMap()
 	}
 	b, _ := json.Marshal(m)
 	return b
@@ -325,7 +394,7 @@ func (tl *termList) display() {
 	tl.RLock()
 	defer tl.RUnlock()
 	for i, term := range tl.terms {
-		DEBUG("Term[", i, "]:", term.ToString())
+		DEBUG("Term[", i, "]:", term.toString(tl.h.syntax))
 	}
 }
 
@@ -390,7 +459,7 @@ func (h *Handler) DisplayConjRevs2() {
 		}
 		DEBUG("***** size:", i, "*****")
 		for _, termrvs := range termlist {
-			s := fmt.Sprint(h.terms.terms[termrvs.termId].ToString(), " ->")
+			s := fmt.Sprint(h.terms.terms[termrvs.termId].toString(h.syntax), " ->")
 			for _, cpair := range termrvs.cList {
 				var op string
 				if cpair.belong {
@@ -0,0 +1,110 @@
+package godnf_test
+
+import (
+	"testing"
+
+	dnf "github.com/brg-liuwei/godnf"
+)
+
+func TestParseExists(t *testing.T) {
+	setDelim()
+	for _, c := range []struct {
+		dnf      string
+		expected string
+	}{
+		{"(has device_id and region in {SH})", "(has device_id and region in {SH})"},
+		{"(MISSING gps) or (Has \"device id\")", "(missing gps) or (has \"device id\")"},
+		{"(has in {a} and missing not in {b})", "(has in {a} and missing not in {b})"},
+	} {
+		expr, err := dnf.ParseDNF(c.dnf)
+		if err != nil {
+			t.Errorf("unexpected error when ParseDNF %q: %v", c.dnf, err)
+			continue
+		}
+		if got := expr.String(); got != c.expected {
+			t.Errorf("unexpected dnf of %q: %s", c.dnf, got)
+		}
+	}
+
+	for _, s := range []string{
+		"(missing)",
+		"(has gps and gps in {1})",
+		"(has gps missing)",
+	} {
+		if err := dnf.DnfCheck(s); err == nil {
+			t.Error("expect error when DnfCheck: ", s)
+		}
+	}
+
+	b, err := dnf.DNFToJSON("(has device_id and missing gps)")
+	if err != nil {
+		t.Fatal("unexpected error when DNFToJSON: ", err)
+	}
+	if string(b) != `{"or":[{"and":[{"key":"device_id","has":true},{"key":"gps","missing":true}]}]}` {
+		t.Error("unexpected json: ", string(b))
+	}
+	if s, err := dnf.JSONToDNF(b); err != nil || s != "(has device_id and missing gps)" {
+		t.Error("unexpected dnf from json: ", s, err)
+	}
+}
+
+func TestExistsBoolExpr(t *testing.T) {
+	setDelim()
+	for _, c := range []struct {
+		s        string
+		expected string
+	}{
+		{"not has gps", "(missing gps)"},
+		{"not (missing gps or region in {SH})", "(has gps and region not in {SH})"},
+		{"has k and k in {a}", "(k in {a})"},
+		{"missing k and not k in {a}", "(missing k)"},
+		{"(missing k and k in {a}) or has j", "(has j)"},
+	} {
+		b, err := dnf.ParseBoolExpr(c.s)
+		if err != nil {
+			t.Errorf("unexpected error when ParseBoolExpr %q: %v", c.s, err)
+			continue
+		}
+		expr, err := b.DNF(dnf.DefaultMaxConjunctions)
+		if err != nil {
+			t.Errorf("unexpected error when DNF %q: %v", c.s, err)
+			continue
+		}
+		if got := expr.String(); got != c.expected {
+			t.Errorf("dnf of %q:\n  got:    %s\n  expect: %s", c.s, got, c.expected)
+		}
+	}
+}
+
+func TestExistsRetrieval(t *testing.T) {
+	h := dnf.NewHandlerWithoutLock()
+	for i, s := range []string{
+		"(has device_id and region in {SH})", // docid: 0
+		"(missing gps)",                      // docid: 1, a conjunction of size 0
+		"(missing gps and region in {SH})",   // docid: 2
+		"(has device_id)",                    // docid: 3
+	} {
+		if err := h.AddDoc("doc", string(rune('0'+i)), s, attr{i, "doc"}); err != nil {
+			t.Fatal("unexpected error when AddDoc: ", err)
+		}
+	}
+
+	for _, c := range []struct {
+		conds    []dnf.Cond
+		expected []int
+	}{
+		{[]dnf.Cond{{"region", "SH"}}, []int{1, 2}},
+		{[]dnf.Cond{{"region", "SH"}, {"device_id", "x"}}, []int{0, 1, 2, 3}},
+		{[]dnf.Cond{{"device_id", ""}, {"gps", "1.2,3.4"}}, []int{3}},
+		{[]dnf.Cond{{"gps", "1.2,3.4"}}, []int{}},
+		{[]dnf.Cond{{"age", "3"}}, []int{1}},
+	} {
+		docs, err := h.SearchAll(c.conds)
+		if err != nil {
+			t.Fatal("unexpected error when Search: ", err)
+		}
+		if !sameDocs(h, docs, c.expected) {
+			t.Errorf("unexpected docs of %v: %v, expect %v", c.conds, docs, c.expected)
+		}
+	}
+}
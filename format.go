@@ -0,0 +1,183 @@
+package godnf
+
+import (
+	"sort"
+	"strings"
+)
+
+// Print prints expr in the canonical syntax of s, whatever aliases expr was written with:
+//
+//	(region = SH AND age != 3) || (gender IN {male})
+//
+// is printed as
+//
+//	(region in {SH} and age not in {3}) or (gender in {male})
+func (s Syntax) Print(expr *Expr) string {
+	conjs := make([]string, 0, len(expr.Conjs))
+	for _, conj := range expr.Conjs {
+		conjs = append(conjs, s.printConj(conj))
+	}
+	return strings.Join(conjs, " or ")
+}
+
+func (s Syntax) printConj(conj *Conjunction) string {
+	amts := make([]string, 0, len(conj.Amts))
+	for _, amt := range conj.Amts {
+		amts = append(amts, s.printAmt(amt))
+	}
+	return string(s.LeftDelimOfConj) + strings.Join(amts, " and ") + string(s.RightDelimOfConj)
+}
+
+func (s Syntax) printAmt(amt *Assignment) string {
+	if amt.Exists && amt.Belong {
+		return "has " + s.quote(amt.Key)
+	} else if amt.Exists {
+		return "missing " + s.quote(amt.Key)
+	}
+	if amt.Bucket != nil {
+		return s.printBucket(amt.Key, amt.Bucket) + printRange(amt.Belong, amt.Range)
+	}
+	if amt.Range != nil {
+		return s.quote(amt.Key) + printRange(amt.Belong, amt.Range)
+	}
+	if amt.Week != nil && amt.Belong {
+		return s.quote(amt.Key) + " in " + s.printWeek(amt.Week)
+	} else if amt.Week != nil {
+		return s.quote(amt.Key) + " not in " + s.printWeek(amt.Week)
+	}
+	if amt.NamedSet != "" && amt.Belong {
+		return s.quote(amt.Key) + " in @" + s.quote(amt.NamedSet)
+	} else if amt.NamedSet != "" {
+		return s.quote(amt.Key) + " not in @" + s.quote(amt.NamedSet)
+	}
+	if amt.Geo != nil && amt.Belong {
+		return s.quote(amt.Key) + " within " + s.printGeo(amt.Geo)
+	} else if amt.Geo != nil {
+		return s.quote(amt.Key) + " not within " + s.printGeo(amt.Geo)
+	}
+	vals := make([]string, 0, len(amt.Vals))
+	for _, val := range amt.Vals {
+		vals = append(vals, s.quote(val))
+	}
+	op := " in "
+	switch {
+	case amt.Under && amt.Belong:
+		op = " under "
+	case amt.Under:
+		op = " not under "
+	case amt.CIDR && amt.Belong:
+		op = " in cidr "
+	case amt.CIDR:
+		op = " not in cidr "
+	case !amt.Belong:
+		op = " not in "
+	}
+	return s.quote(amt.Key) + op +
+		string(s.LeftDelimOfSet) + strings.Join(vals, string(s.SeparatorOfSet)+" ") + string(s.RightDelimOfSet)
+}
+
+// printRange prints range as a comparison if it has an unbounded side: age >= 18,
+// or as an interval: age in [18, 35), age not in (60, +inf)
+func printRange(belong bool, r *Range) string {
+	switch {
+	case belong && r.Min == "" && r.Max != "" && r.MaxIncl:
+		return " <= " + r.Max
+	case belong && r.Min == "" && r.Max != "":
+		return " < " + r.Max
+	case belong && r.Min != "" && r.Max == "" && r.MinIncl:
+		return " >= " + r.Min
+	case belong && r.Min != "" && r.Max == "":
+		return " > " + r.Min
+	case belong:
+		return " in " + r.String()
+	}
+	return " not in " + r.String()
+}
+
+// String prints expr in the canonical default syntax, which can be parsed back by ParseDNF
+func (expr *Expr) String() string {
+	return DefaultSyntax().Print(expr)
+}
+
+// String prints conj in the canonical default syntax
+func (conj *Conjunction) String() string {
+	return DefaultSyntax().printConj(conj)
+}
+
+// String prints amt in the canonical default syntax
+func (amt *Assignment) String() string {
+	return DefaultSyntax().printAmt(amt)
+}
+
+// FormatDNF formats dnf into the canonical form with the default syntax, see Syntax.Format
+func FormatDNF(dnf string) (string, error) {
+	return DefaultSyntax().Format(dnf)
+}
+
+// Format formats dnf into the canonical form:
+// spaces are normalized, assignments in each conjunction are sorted by key,
+// values in each set are sorted and deduplicated, and duplicate conjunctions are removed
+func (s Syntax) Format(dnf string) (string, error) {
+	expr, err := s.Parse(dnf)
+	if err != nil {
+		return "", err
+	}
+	return s.Print(expr.Canonical()), nil
+}
+
+// Canonical returns a copy of expr in canonical order, see Syntax.Format
+func (expr *Expr) Canonical() *Expr {
+	rc := &Expr{Conjs: make([]*Conjunction, 0, len(expr.Conjs))}
+	seen := make(map[string]bool, len(expr.Conjs))
+	for _, conj := range expr.Conjs {
+		c := &Conjunction{Pos: conj.Pos, Amts: make([]*Assignment, 0, len(conj.Amts))}
+		for _, amt := range conj.Amts {
+			a := *amt
+			if amt.Range == nil {
+				a.Vals = sortVals(amt.Vals)
+			}
+			c.Amts = append(c.Amts, &a)
+		}
+		sort.Stable(amtsByKey(c.Amts))
+
+		// DefaultSyntax is enough to tell conjunctions apart
+		if str := c.String(); !seen[str] {
+			seen[str] = true
+			rc.Conjs = append(rc.Conjs, c)
+		}
+	}
+	return rc
+}
+
+// sortVals returns sorted and deduplicated vals
+func sortVals(vals []string) []string {
+	rc := append(make([]string, 0, len(vals)), vals...)
+	sort.Strings(rc)
+	n := 0
+	for i, val := range rc {
+		if i == 0 || val != rc[n-1] {
+			rc[n] = val
+			n++
+		}
+	}
+	return rc[:n]
+}
+
+// for sort interface
+type amtsByKey []*Assignment
+
+func (p amtsByKey) Len() int { return len(p) }
+func (p amtsByKey) Less(i, j int) bool {
+	if p[i].Key != p[j].Key {
+		return p[i].Key < p[j].Key
+	}
+	// a key may be assigned several times, e.g. bucket(uid, 100) and uid
+	if ti, tj := p[i].target(), p[j].target(); ti != tj {
+		return ti < tj
+	}
+	if p[i].Belong != p[j].Belong {
+		return p[i].Belong
+	}
+	return p[i].String() < p[j].String()
+}
+func (p amtsByKey) Swap(i, j int) { p[i], p[j] = p[j], p[i] }
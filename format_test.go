@@ -0,0 +1,62 @@
+package godnf_test
+
+import (
+	"fmt"
+	"testing"
+
+	dnf "github.com/brg-liuwei/godnf"
+)
+
+func TestFormatDNF(t *testing.T) {
+	setDelim()
+	checkFormat := func(s, expected string) {
+		got, err := dnf.FormatDNF(s)
+		if err != nil {
+			t.Errorf("unexpected error when FormatDNF %q: %v", s, err)
+			return
+		}
+		if got != expected {
+			t.Errorf("format of %q:\n  got:    %s\n  expect: %s", s, got, expected)
+		}
+		// canonical form is stable
+		if again, _ := dnf.FormatDNF(got); again != got {
+			t.Errorf("format of %q is not stable: %s", got, again)
+		}
+	}
+
+	checkFormat("  ( region in {SH,BJ , SH}   and  age NOT IN {4,3})  ", "(age not in {3, 4} and region in {BJ, SH})")
+	checkFormat("(b = 1) or (a = 1) or (b in {1})", "(b in {1}) or (a in {1})")
+	checkFormat("(age != 3 && region in {SH, BJ}) || (region in {BJ, SH} and age not in {3})", "(age not in {3} and region in {BJ, SH})")
+	checkFormat(`(city in {"São Paulo", "New York", BJ})`, `(city in {BJ, "New York", "São Paulo"})`)
+	checkFormat("(uid in {3} and bucket(uid, 100) in [0, 10))", "(bucket(uid, 100) in [0, 10) and uid in {3})")
+	checkFormat("(bucket(uid, 100) in [0, 10) and uid in {3})", "(bucket(uid, 100) in [0, 10) and uid in {3})")
+
+	if _, err := dnf.FormatDNF("(region in {SH}"); err == nil {
+		t.Error("expect error when FormatDNF a bad dnf")
+	}
+}
+
+func TestExprString(t *testing.T) {
+	setDelim()
+	s := `(city in {"New York", BJ} and age not in {3}) or (gender in {male})`
+	expr, err := dnf.ParseDNF(s)
+	if err != nil {
+		t.Fatal("unexpected error when ParseDNF: ", err)
+	}
+	if expr.String() != s {
+		t.Error("unexpected string of expr: ", expr.String())
+	}
+	if str := expr.Conjs[0].Amts[0].String(); str != `city in {"New York", BJ}` {
+		t.Error("unexpected string of assignment: ", str)
+	}
+}
+
+func ExampleFormatDNF() {
+	s, err := dnf.FormatDNF("(region IN {SH, BJ, SH} && age != 3) || (age not in {3} and region in {BJ, SH})")
+	if err != nil {
+		panic(err)
+	}
+	fmt.Println(s)
+	// Output:
+	// (age not in {3} and region in {BJ, SH})
+}
@@ -0,0 +1,397 @@
+package godnf
+
+import (
+	"errors"
+	"math"
+	"strconv"
+	"strings"
+)
+
+// keys of the location in search conds, which are matched by geo predicates
+const (
+	GeoLatKey = "lat"
+	GeoLonKey = "lon"
+)
+
+// GeoArea is the area of a geo predicate, a circle like
+//
+//	geo within {31.23, 121.47, 5km}
+//
+// or a polygon registered by Handler.RegisterPolygon like
+//
+//	geo within polygon {pudong}
+type GeoArea struct {
+	Lat     string `json:"lat,omitempty"`     // latitude of center of circle in degrees
+	Lon     string `json:"lon,omitempty"`     // longitude of center of circle in degrees
+	Radius  string `json:"radius,omitempty"`  // radius of circle like 500m or 5km
+	Polygon string `json:"polygon,omitempty"` // name of polygon, the area is a polygon if it is not ""
+}
+
+// String prints area in the default syntax
+func (area *GeoArea) String() string {
+	return DefaultSyntax().printGeo(area)
+}
+
+func (s Syntax) printGeo(area *GeoArea) string {
+	if area.Polygon != "" {
+		return "polygon " + string(s.LeftDelimOfSet) + s.quote(area.Polygon) + string(s.RightDelimOfSet)
+	}
+	sep := string(s.SeparatorOfSet) + " "
+	return string(s.LeftDelimOfSet) + area.Lat + sep + area.Lon + sep + area.Radius + string(s.RightDelimOfSet)
+}
+
+// canonical returns the area with normalized numbers, 5km and 5000m are the same radius
+func (area *GeoArea) canonical() string {
+	if area.Polygon != "" {
+		return "polygon {" + strconv.Quote(area.Polygon) + "}"
+	}
+	lat, _ := parseNumber(area.Lat)
+	lon, _ := parseNumber(area.Lon)
+	radius, _ := parseDistance(area.Radius)
+	return "{" + strconv.FormatFloat(lat, 'g', -1, 64) + ", " + strconv.FormatFloat(lon, 'g', -1, 64) +
+		", " + strconv.FormatFloat(radius, 'g', -1, 64) + "m}"
+}
+
+// check returns false and the reason if area is not a valid circle
+func (area *GeoArea) check() (msg string, ok bool) {
+	if area.Polygon != "" {
+		return "", true
+	}
+	if lat, err := parseNumber(area.Lat); err != nil || lat < -90 || lat > 90 {
+		return "invalid latitude " + area.Lat, false
+	}
+	if lon, err := parseNumber(area.Lon); err != nil || lon < -180 || lon > 180 {
+		return "invalid longitude " + area.Lon, false
+	}
+	if r, err := parseDistance(area.Radius); err != nil || r <= 0 {
+		return "invalid radius " + area.Radius, false
+	}
+	return "", true
+}
+
+// parseDistance parses a distance like 500m or 5km in meters
+func parseDistance(s string) (float64, error) {
+	unit := 1.0
+	switch {
+	case strings.HasSuffix(s, "km"):
+		s, unit = s[:len(s)-2], 1000
+	case strings.HasSuffix(s, "m"):
+		s = s[:len(s)-1]
+	}
+	d, err := parseNumber(s)
+	return d * unit, err
+}
+
+// geo: {31.23, 121.47, 5km} or polygon {pudong}
+func (p *parser) parseGeo() (*GeoArea, error) {
+	p.skipSpace()
+	start := p.pos
+	isPolygon := !p.syntax.isSetDelim(p.peek())
+	if isPolygon {
+		if !isKeyword(p.word(), "polygon") {
+			return nil, p.errorAt(start, string(p.syntax.LeftDelimOfSet), "polygon")
+		}
+		p.skipSpace()
+		start = p.pos
+	}
+
+	vals, err := p.parseSet()
+	if err != nil {
+		return nil, err
+	}
+	area := &GeoArea{}
+	switch {
+	case isPolygon && len(vals) == 1:
+		area.Polygon = vals[0]
+	case isPolygon:
+		perr := p.errorAt(start)
+		perr.Msg = "expect a polygon name"
+		return nil, perr
+	case len(vals) == 3:
+		area.Lat, area.Lon, area.Radius = vals[0], vals[1], vals[2]
+	default:
+		perr := p.errorAt(start)
+		perr.Msg = "expect latitude, longitude and radius of circle"
+		return nil, perr
+	}
+	if msg, ok := area.check(); !ok {
+		perr := p.errorAt(start)
+		perr.Msg = msg
+		return nil, perr
+	}
+	return area, nil
+}
+
+// GeoPoint is a point of polygon in degrees
+type GeoPoint struct {
+	Lat float64
+	Lon float64
+}
+
+// geoShape tells whether a point is in an area, with the bounding boxes of area
+type geoShape interface {
+	contains(lat, lon float64) bool
+	bounds() []geoBox
+}
+
+// geoBox is a bounding box in degrees, minLon <= maxLon
+type geoBox struct {
+	minLat, minLon, maxLat, maxLon float64
+}
+
+const earthRadius = 6371008.8 // mean radius in meters
+
+type geoCircle struct {
+	lat, lon, radius float64
+}
+
+func (c *geoCircle) contains(lat, lon float64) bool {
+	return geoDistance(c.lat, c.lon, lat, lon) <= c.radius
+}
+
+// geoDistance is the haversine distance in meters
+func geoDistance(lat1, lon1, lat2, lon2 float64) float64 {
+	rad := math.Pi / 180
+	dlat, dlon := (lat2-lat1)*rad, (lon2-lon1)*rad
+	a := math.Sin(dlat/2)*math.Sin(dlat/2) +
+		math.Cos(lat1*rad)*math.Cos(lat2*rad)*math.Sin(dlon/2)*math.Sin(dlon/2)
+	return 2 * earthRadius * math.Asin(math.Min(1, math.Sqrt(a)))
+}
+
+// geoToward returns the point at distance meters from lat1, lon1 on the great circle towards lat2, lon2,
+// a negative distance goes the opposite way
+func geoToward(lat1, lon1, lat2, lon2, distance float64) (lat, lon float64) {
+	rad := math.Pi / 180
+	phi1, phi2, dlon := lat1*rad, lat2*rad, (lon2-lon1)*rad
+	bearing := math.Atan2(math.Sin(dlon)*math.Cos(phi2),
+		math.Cos(phi1)*math.Sin(phi2)-math.Sin(phi1)*math.Cos(phi2)*math.Cos(dlon))
+	delta := distance / earthRadius
+	phi := math.Asin(math.Sin(phi1)*math.Cos(delta) + math.Cos(phi1)*math.Sin(delta)*math.Cos(bearing))
+	lambda := lon1*rad + math.Atan2(math.Sin(bearing)*math.Sin(delta)*math.Cos(phi1),
+		math.Cos(delta)-math.Sin(phi1)*math.Sin(phi))
+	lon = math.Mod(lambda/rad+540, 360) - 180
+	return phi / rad, lon
+}
+
+// bounds splits the box of a circle crossing the antimeridian into two boxes
+func (c *geoCircle) bounds() []geoBox {
+	dlat := c.radius / earthRadius * 180 / math.Pi
+	minLat, maxLat := math.Max(-90, c.lat-dlat), math.Min(90, c.lat+dlat)
+	cos := math.Cos(math.Max(math.Abs(minLat), math.Abs(maxLat)) * math.Pi / 180)
+	if cos <= dlat/180 {
+		// too close to poles
+		return []geoBox{{minLat, -180, maxLat, 180}}
+	}
+	minLon, maxLon := c.lon-dlat/cos, c.lon+dlat/cos
+	switch {
+	case minLon < -180 && maxLon > 180:
+		return []geoBox{{minLat, -180, maxLat, 180}}
+	case minLon < -180:
+		return []geoBox{{minLat, -180, maxLat, maxLon}, {minLat, minLon + 360, maxLat, 180}}
+	case maxLon > 180:
+		return []geoBox{{minLat, minLon, maxLat, 180}, {minLat, -180, maxLat, maxLon - 360}}
+	}
+	return []geoBox{{minLat, minLon, maxLat, maxLon}}
+}
+
+// circle returns the circle of area, which must be a valid circle
+func (area *GeoArea) circle() *geoCircle {
+	lat, _ := parseNumber(area.Lat)
+	lon, _ := parseNumber(area.Lon)
+	radius, _ := parseDistance(area.Radius)
+	return &geoCircle{lat: lat, lon: lon, radius: radius}
+}
+
+type geoPolygon []GeoPoint
+
+// contains casts a ray along longitude, points on edges may be either in or out
+func (poly geoPolygon) contains(lat, lon float64) bool {
+	in := false
+	for i, j := 0, len(poly)-1; i < len(poly); j, i = i, i+1 {
+		a, b := poly[i], poly[j]
+		if (a.Lat > lat) != (b.Lat > lat) && lon < (b.Lon-a.Lon)*(lat-a.Lat)/(b.Lat-a.Lat)+a.Lon {
+			in = !in
+		}
+	}
+	return in
+}
+
+// bounds is a single box, RegisterPolygon rejects polygons crossing the antimeridian
+func (poly geoPolygon) bounds() []geoBox {
+	box := geoBox{90, 180, -90, -180}
+	for _, pt := range poly {
+		box.minLat, box.maxLat = math.Min(box.minLat, pt.Lat), math.Max(box.maxLat, pt.Lat)
+		box.minLon, box.maxLon = math.Min(box.minLon, pt.Lon), math.Max(box.maxLon, pt.Lon)
+	}
+	return []geoBox{box}
+}
+
+// RegisterPolygon registers a polygon which can be referenced by name in geo predicates,
+// a polygon should be registered before adding docs referencing it and can not be changed.
+// Polygons crossing the antimeridian are not supported: an edge spanning more than 180
+// degrees of longitude is an error, such a polygon should be split at ±180 into two
+func (h *Handler) RegisterPolygon(name string, points []GeoPoint) error {
+	if len(points) < 3 {
+		return errors.New("polygon " + name + " has less than 3 points")
+	}
+	for i, pt := range points {
+		if pt.Lat < -90 || pt.Lat > 90 || pt.Lon < -180 || pt.Lon > 180 {
+			return errors.New("polygon " + name + " has invalid point " + formatPoint(pt))
+		}
+		if prev := points[(i+len(points)-1)%len(points)]; math.Abs(pt.Lon-prev.Lon) > 180 {
+			return errors.New("polygon " + name + " crosses the antimeridian between " +
+				formatPoint(prev) + " and " + formatPoint(pt))
+		}
+	}
+
+	h.geosLock.Lock()
+	defer h.geosLock.Unlock()
+	if _, ok := h.polygons[name]; ok {
+		return errors.New("polygon " + name + " already registered")
+	}
+	h.polygons[name] = append(geoPolygon(nil), points...)
+	return nil
+}
+
+func formatPoint(pt GeoPoint) string {
+	return strconv.FormatFloat(pt.Lat, 'g', -1, 64) + ", " + strconv.FormatFloat(pt.Lon, 'g', -1, 64)
+}
+
+// geoCheck returns an error if expr references unregistered polygons
+func (h *Handler) geoCheck(expr *Expr) error {
+	h.geosLock.RLock()
+	defer h.geosLock.RUnlock()
+	for _, conj := range expr.Conjs {
+		for _, amt := range conj.Amts {
+			if amt.Geo == nil || amt.Geo.Polygon == "" {
+				continue
+			}
+			if _, ok := h.polygons[amt.Geo.Polygon]; !ok {
+				return errors.New("polygon " + amt.Geo.Polygon + " not registered")
+			}
+		}
+	}
+	return nil
+}
+
+// geoCell is a cell of level in the grid, cells of level l are 0.01 * 2^l degrees wide
+type geoCell struct {
+	level int
+	x, y  int
+}
+
+const geoLevels = 15 // cells of the top level are 163.84 degrees wide, so any box covers at most 4x4 of them
+
+func geoCellOf(level int, lat, lon float64) geoCell {
+	size := 0.01 * float64(int(1)<<uint(level))
+	return geoCell{level: level, x: int(math.Floor(lon / size)), y: int(math.Floor(lat / size))}
+}
+
+// geoIndex indexes geo terms of a key in a multi-level grid,
+// a term is indexed in the cells of the smallest level where each of its bounding boxes covers at most 4x4 cells,
+// so a lookup visits a single cell of each level, and checks candidates by their exact shapes
+type geoIndex struct {
+	cells  map[geoCell][]int
+	shapes map[int]geoShape
+}
+
+func newGeoIndex() *geoIndex {
+	return &geoIndex{cells: make(map[geoCell][]int), shapes: make(map[int]geoShape)}
+}
+
+func (idx *geoIndex) add(shape geoShape, termId int) {
+	if _, ok := idx.shapes[termId]; ok {
+		return
+	}
+	idx.shapes[termId] = shape
+
+	boxes := shape.bounds()
+	for level := 0; level < geoLevels; level++ {
+		fits := true
+		for _, box := range boxes {
+			lo, hi := geoCellOf(level, box.minLat, box.minLon), geoCellOf(level, box.maxLat, box.maxLon)
+			fits = fits && hi.x-lo.x < 4 && hi.y-lo.y < 4
+		}
+		if !fits {
+			continue
+		}
+		for _, box := range boxes {
+			lo, hi := geoCellOf(level, box.minLat, box.minLon), geoCellOf(level, box.maxLat, box.maxLon)
+			for x := lo.x; x <= hi.x; x++ {
+				for y := lo.y; y <= hi.y; y++ {
+					cell := geoCell{level: level, x: x, y: y}
+					if ids := idx.cells[cell]; len(ids) == 0 || ids[len(ids)-1] != termId {
+						idx.cells[cell] = append(ids, termId)
+					}
+				}
+			}
+		}
+		return
+	}
+}
+
+// lookup appends ids of terms whose area contains the point to ids
+func (idx *geoIndex) lookup(lat, lon float64, ids []int) []int {
+	for level := 0; level < geoLevels; level++ {
+		for _, id := range idx.cells[geoCellOf(level, lat, lon)] {
+			if idx.shapes[id].contains(lat, lon) {
+				ids = append(ids, id)
+			}
+		}
+	}
+	return ids
+}
+
+// geoIndexAdd indexes geo term of key, polygons of area must be registered
+func (h *Handler) geoIndexAdd(key string, area *GeoArea, termId int) {
+	h.geosLock.Lock()
+	defer h.geosLock.Unlock()
+
+	var shape geoShape
+	if area.Polygon != "" {
+		shape = h.polygons[area.Polygon]
+	} else {
+		shape = area.circle()
+	}
+
+	idx, ok := h.geos[key]
+	if !ok {
+		idx = newGeoIndex()
+		h.geos[key] = idx
+	}
+	idx.add(shape, termId)
+}
+
+// geoLookup appends ids of geo terms containing the location of conds to termids
+func (h *Handler) geoLookup(conds []Cond, termids []int) []int {
+	h.geosLock.RLock()
+	defer h.geosLock.RUnlock()
+	if len(h.geos) == 0 {
+		return termids
+	}
+
+	var lat, lon float64
+	found := 0
+	for i := range conds {
+		var err error
+		switch conds[i].Key {
+		case GeoLatKey:
+			lat, err = parseNumber(conds[i].Val)
+		case GeoLonKey:
+			lon, err = parseNumber(conds[i].Val)
+		default:
+			continue
+		}
+		if err != nil {
+			return termids
+		}
+		found++
+	}
+	if found != 2 {
+		return termids
+	}
+	for _, idx := range h.geos {
+		termids = idx.lookup(lat, lon, termids)
+	}
+	return termids
+}
@@ -0,0 +1,134 @@
+package godnf_test
+
+import (
+	"testing"
+
+	dnf "github.com/brg-liuwei/godnf"
+)
+
+func TestParseGeo(t *testing.T) {
+	setDelim()
+	for _, c := range []struct {
+		dnf      string
+		expected string
+	}{
+		{"(region in {SH} and geo within {31.23,121.47,5km})", "(geo within {31.23, 121.47, 5km} and region in {SH})"},
+		{"(geo NOT WITHIN polygon {pudong})", "(geo not within polygon {pudong})"},
+	} {
+		if got, err := dnf.FormatDNF(c.dnf); err != nil {
+			t.Errorf("unexpected error when FormatDNF %q: %v", c.dnf, err)
+		} else if got != c.expected {
+			t.Errorf("unexpected dnf of %q: %s", c.dnf, got)
+		}
+	}
+
+	b, err := dnf.DNFToJSON("(geo within {31.23, 121.47, 500m})")
+	if err != nil {
+		t.Fatal("unexpected error when DNFToJSON: ", err)
+	}
+	if string(b) != `{"or":[{"and":[{"key":"geo","within":{"lat":"31.23","lon":"121.47","radius":"500m"}}]}]}` {
+		t.Error("unexpected json: ", string(b))
+	}
+	if s, err := dnf.JSONToDNF([]byte(`{"or":[{"and":[{"key":"geo","not_within":{"polygon":"pudong"}}]}]}`)); err != nil {
+		t.Error("unexpected error when JSONToDNF: ", err)
+	} else if s != "(geo not within polygon {pudong})" {
+		t.Error("unexpected dnf: ", s)
+	}
+
+	for _, s := range []string{
+		"(geo within {31.23, 121.47})",
+		"(geo within {91, 121.47, 5km})",
+		"(geo within {31.23, 181, 5km})",
+		"(geo within {31.23, 121.47, 5mi})",
+		"(geo within {31.23, 121.47, -5km})",
+		"(geo within polygon {a, b})",
+		"(geo within polygons {a})",
+	} {
+		if err := dnf.DnfCheck(s); err == nil {
+			t.Error("expect error when DnfCheck: ", s)
+		}
+	}
+}
+
+func TestGeoRetrieval(t *testing.T) {
+	h := dnf.NewHandlerWithoutLock()
+	if err := h.AddDoc("doc", "0", "(geo within polygon {pudong})", attr{0, "doc"}); err == nil {
+		t.Error("expect error when AddDoc with an unregistered polygon")
+	}
+	pudong := []dnf.GeoPoint{{31.15, 121.50}, {31.30, 121.50}, {31.30, 121.70}, {31.15, 121.70}}
+	if err := h.RegisterPolygon("pudong", pudong); err != nil {
+		t.Fatal("unexpected error when RegisterPolygon: ", err)
+	}
+	if err := h.RegisterPolygon("pudong", pudong); err == nil {
+		t.Error("expect error when RegisterPolygon twice")
+	}
+	if err := h.RegisterPolygon("line", pudong[:2]); err == nil {
+		t.Error("expect error when RegisterPolygon with 2 points")
+	}
+	fiji := []dnf.GeoPoint{{-16, 177}, {-16, -179}, {-19, -179}, {-19, 177}}
+	if err := h.RegisterPolygon("fiji", fiji); err == nil {
+		t.Error("expect error when RegisterPolygon crossing the antimeridian")
+	}
+
+	for i, s := range []string{
+		"(region in {SH} and geo within {31.23, 121.47, 5km})", // docid: 0
+		"(geo within polygon {pudong})",                        // docid: 1
+		"(geo not within {31.23, 121.47, 5000m})",              // docid: 2
+		"(geo within {0, 0, 20000km})",                         // docid: 3
+	} {
+		if err := h.AddDoc("doc", string(rune('0'+i)), s, attr{i, "doc"}); err != nil {
+			t.Fatal("unexpected error when AddDoc: ", err)
+		}
+	}
+
+	for _, c := range []struct {
+		conds    []dnf.Cond
+		expected []int
+	}{
+		{[]dnf.Cond{{"region", "SH"}, {"lat", "31.25"}, {"lon", "121.49"}}, []int{0, 3}},
+		{[]dnf.Cond{{"region", "BJ"}, {"lat", "31.25"}, {"lon", "121.49"}}, []int{3}},
+		{[]dnf.Cond{{"region", "SH"}, {"lat", "31.25"}, {"lon", "121.55"}}, []int{1, 2, 3}},
+		{[]dnf.Cond{{"region", "SH"}, {"lat", "31.30"}, {"lon", "121.47"}}, []int{2, 3}},
+		{[]dnf.Cond{{"region", "SH"}, {"lat", "31.25"}}, []int{2}},
+		{[]dnf.Cond{{"lat", "-31.25"}, {"lon", "-121.49"}}, []int{2, 3}},
+	} {
+		docs, err := h.SearchAll(c.conds)
+		if err != nil {
+			t.Fatal("unexpected error when Search: ", err)
+		}
+		if !sameDocs(h, docs, c.expected) {
+			t.Errorf("unexpected docs of %v: %v, expect %v", c.conds, docs, c.expected)
+		}
+	}
+}
+
+func TestGeoAntimeridian(t *testing.T) {
+	h := dnf.NewHandlerWithoutLock()
+	for i, s := range []string{
+		"(geo within {-17.7, 179.99, 2km})",  // docid: 0
+		"(geo within {-17.7, -179.99, 2km})", // docid: 1
+	} {
+		if err := h.AddDoc("doc", string(rune('0'+i)), s, attr{i, "doc"}); err != nil {
+			t.Fatal("unexpected error when AddDoc: ", err)
+		}
+	}
+
+	for _, c := range []struct {
+		conds    []dnf.Cond
+		expected []int
+	}{
+		{[]dnf.Cond{{"lat", "-17.7"}, {"lon", "179.995"}}, []int{0, 1}},
+		{[]dnf.Cond{{"lat", "-17.7"}, {"lon", "-179.995"}}, []int{0, 1}},
+		{[]dnf.Cond{{"lat", "-17.7"}, {"lon", "-179.98"}}, []int{1}},
+		{[]dnf.Cond{{"lat", "-17.7"}, {"lon", "179.98"}}, []int{0}},
+		{[]dnf.Cond{{"lat", "-17.7"}, {"lon", "-179.9"}}, []int{}},
+	} {
+		docs, err := h.SearchAll(c.conds)
+		if err != nil {
+			t.Fatal("unexpected error when Search: ", err)
+		}
+		if !sameDocs(h, docs, c.expected) {
+			t.Errorf("unexpected docs of %v: %v, expect %v", c.conds, docs, c.expected)
+		}
+	}
+}
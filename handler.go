@@ -43,22 +43,68 @@ type Handler struct {
 
 	conjSzRvs     [][]termRvs
 	conjSzRvsLock *rwLockWrapper
+	termShare     int // max ∈ assignments of a conjunction sharing a term, guarded by conjSzRvsLock
+
+	ranges     map[string]*numIndex                // side index of range terms by key
+	buckets    map[string]map[bucketFunc]*numIndex // side index of bucket terms by key and bucket
+	rangesLock *rwLockWrapper
+
+	underKeys map[string]bool // keys of path terms, guarded by termMapLock
+	pathSep   string          // guarded by confLock
+
+	cidrs     map[string]*cidrIndex // side index of cidr terms by key
+	cidrsLock *rwLockWrapper
+
+	geos     map[string]*geoIndex // side index of geo terms by key
+	polygons map[string]geoPolygon
+	geosLock *rwLockWrapper
+
+	namedSets map[string]map[string]bool    // values of named sets by name
+	setRefs   map[string]map[string]*setRef // references to named sets by key and name
+	setsLock  *rwLockWrapper
+
+	weeks     map[string]*weekIndex // side index of week terms by timezone
+	weekTerms map[int]bool          // ids of indexed week terms
+	weeksLock *rwLockWrapper
+	clock     Clock // guarded by confLock
+
+	syntax   Syntax
+	maxConjs int                // max conjunctions generated by AddBoolExpr, guarded by confLock
+	keyTypes map[string]KeyType // types of keys other than NumberKey, guarded by rangesLock
+	confLock *rwLockWrapper
+
+	schema     *Schema               // guarded by confLock
+	schemaKeys map[string]*KeySchema // keys of schema by name, guarded by confLock
+
+	normalizers map[string][]Normalizer // chains of normalizers by key, guarded by confLock
+	taxonomy    *Taxonomy               // normalized taxonomy expanding conds, guarded by confLock
 }
 
 var currentHandler unsafe.Pointer = nil
 
-// NewHandler creates a dnf handler which is safe for concurrent use by multiple goroutines
+// NewHandler creates a dnf handler with the default syntax
+// which is safe for concurrent use by multiple goroutines
 func NewHandler() *Handler {
-	return newHandler(true)
+	return newHandler(DefaultSyntax(), true)
 }
 
-// NewHandlerWithoutLock creates a dnf handler
+// NewHandlerWithoutLock creates a dnf handler with the default syntax
 // which is unsafe for concurrent use by multiple goroutines
 func NewHandlerWithoutLock() *Handler {
-	return newHandler(false)
+	return newHandler(DefaultSyntax(), false)
+}
+
+// NewHandlerWithSyntax creates a dnf handler which parses docs with syntax,
+// the handler is safe for concurrent use by multiple goroutines iff useLock is true,
+// an error is returned if syntax is invalid, see Syntax.Validate
+func NewHandlerWithSyntax(syntax Syntax, useLock bool) (*Handler, error) {
+	if err := syntax.Validate(); err != nil {
+		return nil, err
+	}
+	return newHandler(syntax, useLock), nil
 }
 
-func newHandler(useLock bool) *Handler {
+func newHandler(syntax Syntax, useLock bool) *Handler {
 	terms := make([]Term, 0, 16)
 	terms = append(terms, Term{id: 0, key: "", val: ""})
 
@@ -92,6 +138,37 @@ func newHandler(useLock bool) *Handler {
 		conjRvsLock:   newRwLockWrapper(useLock),
 		conjSzRvs:     conjSzRvs,
 		conjSzRvsLock: newRwLockWrapper(useLock),
+		termShare:     1,
+
+		ranges:     make(map[string]*numIndex),
+		buckets:    make(map[string]map[bucketFunc]*numIndex),
+		rangesLock: newRwLockWrapper(useLock),
+
+		underKeys: make(map[string]bool),
+		pathSep:   DefaultPathSeparator,
+
+		cidrs:     make(map[string]*cidrIndex),
+		cidrsLock: newRwLockWrapper(useLock),
+
+		geos:     make(map[string]*geoIndex),
+		polygons: make(map[string]geoPolygon),
+		geosLock: newRwLockWrapper(useLock),
+
+		namedSets: make(map[string]map[string]bool),
+		setRefs:   make(map[string]map[string]*setRef),
+		setsLock:  newRwLockWrapper(useLock),
+
+		normalizers: make(map[string][]Normalizer),
+
+		weeks:     make(map[string]*weekIndex),
+		weekTerms: make(map[int]bool),
+		weeksLock: newRwLockWrapper(useLock),
+		clock:     systemClock{},
+
+		syntax:   syntax,
+		maxConjs: DefaultMaxConjunctions,
+		keyTypes: make(map[string]KeyType),
+		confLock: newRwLockWrapper(useLock),
 	}
 	h.docs.h = h
 	h.conjs.h = h
@@ -100,6 +177,27 @@ func newHandler(useLock bool) *Handler {
 	return h
 }
 
+// Syntax returns the syntax of docs added to this handler
+func (h *Handler) Syntax() Syntax {
+	return h.syntax
+}
+
+// SetMaxConjunctions set the max number of conjunctions a boolean expression
+// can be converted to by AddBoolExpr, it applies to docs added after it
+func (h *Handler) SetMaxConjunctions(n int) {
+	h.confLock.Lock()
+	h.maxConjs = n
+	h.confLock.Unlock()
+}
+
+// MaxConjunctions returns the max number of conjunctions a boolean expression
+// can be converted to by AddBoolExpr
+func (h *Handler) MaxConjunctions() int {
+	h.confLock.RLock()
+	defer h.confLock.RUnlock()
+	return h.maxConjs
+}
+
 // GetHandler returns current global handler
 func GetHandler() *Handler {
 	return (*Handler)(atomic.LoadPointer(&currentHandler))
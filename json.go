@@ -0,0 +1,314 @@
+package godnf
+
+import (
+	"encoding/json"
+	"fmt"
+	"net"
+)
+
+// JSON representation of Expr:
+//
+//	(region in {SH} and age not in {3}) or (gender in {M})
+//
+// is represented as
+//
+//	{"or": [
+//	    {"and": [{"key": "region", "in": ["SH"]}, {"key": "age", "not_in": ["3"]}]},
+//	    {"and": [{"key": "gender", "in": ["M"]}]}
+//	]}
+//
+// a range like age in [18, 35) is represented as
+//
+//	{"key": "age", "in_range": {"gte": "18", "lt": "35"}}
+//
+// region under {CN/SH} is represented as
+//
+//	{"key": "region", "under": ["CN/SH"]}
+//
+// ip in cidr {10.0.0.0/8} is represented as
+//
+//	{"key": "ip", "in_cidr": ["10.0.0.0/8"]}
+//
+// geo within {31.23, 121.47, 5km} is represented as
+//
+//	{"key": "geo", "within": {"lat": "31.23", "lon": "121.47", "radius": "5km"}}
+//
+// time in week {Mon-Fri 09:00-18:00 Asia/Shanghai} is represented as
+//
+//	{"key": "time", "in_week": ["Mon-Fri 09:00-18:00 Asia/Shanghai"]}
+//
+// region in @tier1_cities is represented as
+//
+//	{"key": "region", "in_set": "tier1_cities"}
+//
+// has device_id is represented as
+//
+//	{"key": "device_id", "has": true}
+//
+// and bucket(user_id, 1000, exp42) in [0, 50) is represented as
+//
+//	{"key": "user_id", "bucket": {"mod": 1000, "salt": "exp42"}, "in_range": {"gte": "0", "lt": "50"}}
+type jsonExpr struct {
+	Or []jsonConj `json:"or"`
+}
+
+type jsonConj struct {
+	And []jsonAmt `json:"and"`
+}
+
+type jsonAmt struct {
+	Key        string     `json:"key"`
+	Bucket     *Bucket    `json:"bucket,omitempty"`
+	InSet      string     `json:"in_set,omitempty"`
+	NotInSet   string     `json:"not_in_set,omitempty"`
+	Has        bool       `json:"has,omitempty"`
+	Missing    bool       `json:"missing,omitempty"`
+	In         []string   `json:"in,omitempty"`
+	NotIn      []string   `json:"not_in,omitempty"`
+	Under      []string   `json:"under,omitempty"`
+	NotUnder   []string   `json:"not_under,omitempty"`
+	InCIDR     []string   `json:"in_cidr,omitempty"`
+	NotInCIDR  []string   `json:"not_in_cidr,omitempty"`
+	InRange    *jsonRange `json:"in_range,omitempty"`
+	NotInRange *jsonRange `json:"not_in_range,omitempty"`
+	Within     *GeoArea   `json:"within,omitempty"`
+	NotWithin  *GeoArea   `json:"not_within,omitempty"`
+	InWeek     []string   `json:"in_week,omitempty"`
+	NotInWeek  []string   `json:"not_in_week,omitempty"`
+}
+
+type jsonRange struct {
+	Gt  string `json:"gt,omitempty"`
+	Gte string `json:"gte,omitempty"`
+	Lt  string `json:"lt,omitempty"`
+	Lte string `json:"lte,omitempty"`
+}
+
+func newJSONRange(r *Range) *jsonRange {
+	jr := &jsonRange{}
+	switch {
+	case r.Min == "":
+	case r.MinIncl:
+		jr.Gte = r.Min
+	default:
+		jr.Gt = r.Min
+	}
+	switch {
+	case r.Max == "":
+	case r.MaxIncl:
+		jr.Lte = r.Max
+	default:
+		jr.Lt = r.Max
+	}
+	return jr
+}
+
+func (jr *jsonRange) toRange() (*Range, string) {
+	if jr.Gt != "" && jr.Gte != "" {
+		return nil, `expect at most one of "gt" and "gte"`
+	}
+	if jr.Lt != "" && jr.Lte != "" {
+		return nil, `expect at most one of "lt" and "lte"`
+	}
+	r := &Range{Min: jr.Gt + jr.Gte, MinIncl: jr.Gte != "", Max: jr.Lt + jr.Lte, MaxIncl: jr.Lte != ""}
+	if msg, ok := r.check(r.keyType()); !ok {
+		return nil, msg
+	}
+	return r, ""
+}
+
+// JSONError describes an invalid JSON representation of Expr
+type JSONError struct {
+	Path string // path of the invalid node, like or[0].and[1]
+	Msg  string
+}
+
+func (e *JSONError) Error() string {
+	if e.Path == "" {
+		return "dnf json error: " + e.Msg
+	}
+	return "dnf json error at " + e.Path + ": " + e.Msg
+}
+
+// MarshalJSON implements json.Marshaler
+func (expr *Expr) MarshalJSON() ([]byte, error) {
+	je := jsonExpr{Or: make([]jsonConj, 0, len(expr.Conjs))}
+	for _, conj := range expr.Conjs {
+		jc := jsonConj{And: make([]jsonAmt, 0, len(conj.Amts))}
+		for _, amt := range conj.Amts {
+			ja := jsonAmt{Key: amt.Key, Bucket: amt.Bucket}
+			switch {
+			case amt.NamedSet != "" && amt.Belong:
+				ja.InSet = amt.NamedSet
+			case amt.NamedSet != "":
+				ja.NotInSet = amt.NamedSet
+			case amt.Exists && amt.Belong:
+				ja.Has = true
+			case amt.Exists:
+				ja.Missing = true
+			case amt.Week != nil && amt.Belong:
+				ja.InWeek = amt.Week
+			case amt.Week != nil:
+				ja.NotInWeek = amt.Week
+			case amt.Geo != nil && amt.Belong:
+				ja.Within = amt.Geo
+			case amt.Geo != nil:
+				ja.NotWithin = amt.Geo
+			case amt.Range != nil && amt.Belong:
+				ja.InRange = newJSONRange(amt.Range)
+			case amt.Range != nil:
+				ja.NotInRange = newJSONRange(amt.Range)
+			case amt.Under && amt.Belong:
+				ja.Under = amt.Vals
+			case amt.Under:
+				ja.NotUnder = amt.Vals
+			case amt.CIDR && amt.Belong:
+				ja.InCIDR = amt.Vals
+			case amt.CIDR:
+				ja.NotInCIDR = amt.Vals
+			case amt.Belong:
+				ja.In = amt.Vals
+			default:
+				ja.NotIn = amt.Vals
+			}
+			jc.And = append(jc.And, ja)
+		}
+		je.Or = append(je.Or, jc)
+	}
+	return json.Marshal(je)
+}
+
+// UnmarshalJSON implements json.Unmarshaler, b is validated as strictly as ParseDNF
+func (expr *Expr) UnmarshalJSON(b []byte) error {
+	var je jsonExpr
+	if err := json.Unmarshal(b, &je); err != nil {
+		return &JSONError{Msg: err.Error()}
+	}
+	if len(je.Or) == 0 {
+		return &JSONError{Path: "or", Msg: "no conjunctions"}
+	}
+
+	conjs := make([]*Conjunction, 0, len(je.Or))
+	for i, jc := range je.Or {
+		path := fmt.Sprintf("or[%d].and", i)
+		if len(jc.And) == 0 {
+			return &JSONError{Path: path, Msg: "no assignments"}
+		}
+		conj := &Conjunction{Amts: make([]*Assignment, 0, len(jc.And))}
+		keys := make(map[string]bool, len(jc.And))
+		for j, ja := range jc.And {
+			path := fmt.Sprintf("%s[%d]", path, j)
+			amt := &Assignment{Key: ja.Key, Bucket: ja.Bucket}
+			n := 0
+			if ja.InSet != "" {
+				amt.Belong, amt.NamedSet, n = true, ja.InSet, n+1
+			}
+			if ja.NotInSet != "" {
+				amt.Belong, amt.NamedSet, n = false, ja.NotInSet, n+1
+			}
+			if ja.Has {
+				amt.Belong, amt.Exists, n = true, true, n+1
+			}
+			if ja.Missing {
+				amt.Belong, amt.Exists, n = false, true, n+1
+			}
+			if len(ja.In) != 0 {
+				amt.Belong, amt.Vals, n = true, ja.In, n+1
+			}
+			if len(ja.NotIn) != 0 {
+				amt.Belong, amt.Vals, n = false, ja.NotIn, n+1
+			}
+			if len(ja.Under) != 0 {
+				amt.Belong, amt.Vals, amt.Under, n = true, ja.Under, true, n+1
+			}
+			if len(ja.NotUnder) != 0 {
+				amt.Belong, amt.Vals, amt.Under, n = false, ja.NotUnder, true, n+1
+			}
+			if len(ja.InCIDR) != 0 {
+				amt.Belong, amt.Vals, amt.CIDR, n = true, ja.InCIDR, true, n+1
+			}
+			if len(ja.NotInCIDR) != 0 {
+				amt.Belong, amt.Vals, amt.CIDR, n = false, ja.NotInCIDR, true, n+1
+			}
+			for _, jr := range []*jsonRange{ja.InRange, ja.NotInRange} {
+				if jr == nil {
+					continue
+				}
+				r, msg := jr.toRange()
+				if r == nil {
+					return &JSONError{Path: path, Msg: msg}
+				}
+				amt.Belong, amt.Range, n = jr == ja.InRange, r, n+1
+			}
+			for i, windows := range [][]string{ja.InWeek, ja.NotInWeek} {
+				if len(windows) == 0 {
+					continue
+				}
+				for _, window := range windows {
+					if _, err := parseWeekWindow(window); err != nil {
+						return &JSONError{Path: path, Msg: err.Error()}
+					}
+				}
+				amt.Belong, amt.Week, n = i == 0, windows, n+1
+			}
+			for _, area := range []*GeoArea{ja.Within, ja.NotWithin} {
+				if area == nil {
+					continue
+				}
+				if msg, ok := area.check(); !ok {
+					return &JSONError{Path: path, Msg: msg}
+				}
+				amt.Belong, amt.Geo, n = area == ja.Within, area, n+1
+			}
+			if amt.CIDR {
+				for _, val := range amt.Vals {
+					if _, _, err := net.ParseCIDR(val); err != nil {
+						return &JSONError{Path: path, Msg: "invalid cidr " + val}
+					}
+				}
+			}
+			if amt.Bucket != nil {
+				if amt.Bucket.Mod <= 0 {
+					return &JSONError{Path: path, Msg: "bucket mod should be positive"}
+				}
+				if amt.Range == nil {
+					return &JSONError{Path: path, Msg: `expect "in_range" or "not_in_range" of bucket`}
+				}
+				if msg, ok := amt.Range.check(NumberKey); !ok {
+					return &JSONError{Path: path, Msg: msg}
+				}
+			}
+			switch {
+			case ja.Key == "":
+				return &JSONError{Path: path, Msg: "no key"}
+			case keys[amt.target()]:
+				return &JSONError{Path: path, Msg: "conjunction key " + ja.Key + " duplicate"}
+			case n != 1:
+				return &JSONError{Path: path, Msg: `expect exactly one of "has", "missing", "in_set", "not_in_set", non-empty "in", "not_in", "under", "not_under", "in_cidr", "not_in_cidr", "in_range", "not_in_range", "within", "not_within", "in_week" and "not_in_week"`}
+			}
+			keys[amt.target()] = true
+			conj.Amts = append(conj.Amts, amt)
+		}
+		conjs = append(conjs, conj)
+	}
+	expr.Conjs = conjs
+	return nil
+}
+
+// DNFToJSON converts dnf in the default syntax to its JSON representation
+func DNFToJSON(dnf string) ([]byte, error) {
+	expr, err := ParseDNF(dnf)
+	if err != nil {
+		return nil, err
+	}
+	return json.Marshal(expr)
+}
+
+// JSONToDNF converts the JSON representation of a dnf to the canonical default syntax
+func JSONToDNF(b []byte) (string, error) {
+	var expr Expr
+	if err := json.Unmarshal(b, &expr); err != nil {
+		return "", err
+	}
+	return expr.String(), nil
+}
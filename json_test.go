@@ -0,0 +1,80 @@
+package godnf_test
+
+import (
+	"encoding/json"
+	"errors"
+	"testing"
+
+	dnf "github.com/brg-liuwei/godnf"
+)
+
+func TestDNFJSON(t *testing.T) {
+	setDelim()
+	s := `(region in {SH, "New York"} and age not in {3}) or (gender in {M})`
+	expected := `{"or":[{"and":[{"key":"region","in":["SH","New York"]},{"key":"age","not_in":["3"]}]},{"and":[{"key":"gender","in":["M"]}]}]}`
+
+	b, err := dnf.DNFToJSON(s)
+	if err != nil {
+		t.Fatal("unexpected error when DNFToJSON: ", err)
+	}
+	if string(b) != expected {
+		t.Error("unexpected json: ", string(b))
+	}
+
+	back, err := dnf.JSONToDNF(b)
+	if err != nil {
+		t.Fatal("unexpected error when JSONToDNF: ", err)
+	}
+	if back != s {
+		t.Error("unexpected dnf: ", back)
+	}
+}
+
+func TestDNFJSONError(t *testing.T) {
+	for _, c := range []struct {
+		json string
+		path string
+	}{
+		{`{"or":[]}`, "or"},
+		{`{"or":[{"and":[]}]}`, "or[0].and"},
+		{`{"or":[{"and":[{"in":["SH"]}]}]}`, "or[0].and[0]"},
+		{`{"or":[{"and":[{"key":"region"}]}]}`, "or[0].and[0]"},
+		{`{"or":[{"and":[{"key":"region","in":["SH"],"not_in":["BJ"]}]}]}`, "or[0].and[0]"},
+		{`{"or":[{"and":[{"key":"age","in":["3"]}]},{"and":[{"key":"region","in":["SH"]},{"key":"region","in":["BJ"]}]}]}`, "or[1].and[1]"},
+	} {
+		var jerr *dnf.JSONError
+		if _, err := dnf.JSONToDNF([]byte(c.json)); !errors.As(err, &jerr) {
+			t.Errorf("expect *JSONError when JSONToDNF %s, got %v", c.json, err)
+		} else if jerr.Path != c.path {
+			t.Errorf("unexpected error path of %s: %s", c.json, jerr.Path)
+		}
+	}
+	if _, err := dnf.JSONToDNF([]byte(`{"or":`)); err == nil {
+		t.Error("expect error when JSONToDNF a bad json")
+	}
+}
+
+func TestAddDocJSON(t *testing.T) {
+	h := dnf.NewHandlerWithoutLock()
+	b := []byte(`{"or":[{"and":[{"key":"region","in":["SH"]},{"key":"age","not_in":["3"]}]}]}`)
+	if err := h.AddDocJSON("doc-0", "0", b, attr{0, "doc-0"}); err != nil {
+		t.Fatal("unexpected error when AddDocJSON: ", err)
+	}
+	if err := h.AddDocJSON("doc-1", "1", []byte(`{"or":[]}`), attr{1, "doc-1"}); err == nil {
+		t.Error("expect error when AddDocJSON a bad json")
+	}
+
+	docs, err := h.SearchAll([]dnf.Cond{{"region", "SH"}, {"age", "4"}})
+	if err != nil || len(docs) != 1 {
+		t.Errorf("unexpected search result: %v, %v", docs, err)
+	}
+
+	var m map[string]map[string]json.RawMessage
+	json.Unmarshal(h.DumpByDocId(), &m)
+	if string(m["0"]["dnf_json"]) != string(b) {
+		t.Error("unexpected dnf_json of dump: ", string(m["0"]["dnf_json"]))
+	}
+	if string(m["0"]["dnf"]) != `"(region in {SH} and age not in {3})"` {
+		t.Error("unexpected dnf of dump: ", string(m["0"]["dnf"]))
+	}
+}
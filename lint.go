@@ -0,0 +1,311 @@
+package godnf
+
+import (
+	"sort"
+	"strconv"
+)
+
+// Severity is the severity of a Diagnostic
+type Severity int
+
+const (
+	SeverityInfo    Severity = iota // the dnf is valid, but may be unexpected
+	SeverityWarning                 // the dnf is valid, but a part of it is useless
+	SeverityError                   // the dnf can not be added, or a conjunction can never be matched
+)
+
+func (s Severity) String() string {
+	switch s {
+	case SeverityInfo:
+		return "info"
+	case SeverityWarning:
+		return "warning"
+	}
+	return "error"
+}
+
+// Diagnostic is a problem of dnf reported by LintDNF
+type Diagnostic struct {
+	Severity Severity
+	Offset   int // byte offset of the problem in dnf
+	Line     int // line of the problem, starts from 1
+	Column   int // column (in runes) of the problem, starts from 1
+	Msg      string
+}
+
+func (d Diagnostic) String() string {
+	return "line " + strconv.Itoa(d.Line) + ", column " + strconv.Itoa(d.Column) + ": " + d.Severity.String() + ": " + d.Msg
+}
+
+// LintOptions are options of LintDNF
+type LintOptions struct {
+	// Handler, if not nil, provides the syntax, key types and the term dictionary,
+	// keys and values unknown to its index are reported
+	Handler *Handler
+	// Syntax of dnf if Handler is nil, the default syntax if it is zero
+	Syntax Syntax
+}
+
+// LintDNF reports problems of dnf sorted by position: syntax errors, conjunctions which can never be matched
+// or are always true, empty sets, duplicate keys and values, conjunctions subsumed by others,
+// and keys or values unknown to the index of handler.
+// Duplicate keys and empty sets are allowed by the linter, so they are reported with other problems
+func LintDNF(dnf string, opts LintOptions) []Diagnostic {
+	syntax := opts.Syntax
+	var keyType func(string) KeyType
+	var multi func(string) bool
+	if opts.Handler != nil {
+		syntax, keyType, multi = opts.Handler.syntax, opts.Handler.KeyType, opts.Handler.multiKey
+	} else if syntax == (Syntax{}) {
+		syntax = DefaultSyntax()
+	}
+
+	l := &linter{dnf: dnf}
+	if err := syntax.Validate(); err != nil {
+		l.report(SeverityError, 0, err.Error())
+		return l.diags
+	}
+	p := &parser{src: dnf, syntax: syntax, lenient: true}
+	expr, err := p.parse()
+	if err != nil {
+		perr := err.(*ParseError)
+		l.report(SeverityError, perr.Offset, perr.Message())
+		return l.diags
+	}
+
+	merged := make([][]*Assignment, len(expr.Conjs))
+	for i, conj := range expr.Conjs {
+		l.lintAmts(conj)
+		if opts.Handler != nil {
+			l.lintTerms(opts.Handler, conj)
+		}
+
+		amts, ok := mergeAmts(conj.Amts, keyType, multi)
+		for _, amt := range amts {
+			ok = ok && !(amt.Belong && amt.emptySet())
+		}
+		if !ok {
+			l.report(SeverityError, conj.Pos, "conjunction can never be matched")
+			continue
+		}
+		merged[i] = amts
+
+		alwaysTrue := true
+		for _, amt := range amts {
+			alwaysTrue = alwaysTrue && amt.alwaysTrue()
+		}
+		if alwaysTrue {
+			l.report(SeverityWarning, conj.Pos, "conjunction is always true")
+		}
+	}
+
+	for i, a := range merged {
+		for j, b := range merged {
+			if i == j || a == nil || b == nil || !subsumes(b, a, keyType, multi) {
+				continue
+			}
+			if j > i && subsumes(a, b, keyType, multi) {
+				// equivalent conjunctions, the latter is reported
+				continue
+			}
+			pos := newParseError(dnf, expr.Conjs[j].Pos, "", nil)
+			l.report(SeverityWarning, expr.Conjs[i].Pos, "conjunction is subsumed by conjunction at line "+
+				strconv.Itoa(pos.Line)+", column "+strconv.Itoa(pos.Column))
+			break
+		}
+	}
+
+	sort.Stable(diagsByOffset(l.diags))
+	return l.diags
+}
+
+type linter struct {
+	dnf   string
+	diags []Diagnostic
+}
+
+func (l *linter) report(severity Severity, offset int, msg string) {
+	pos := newParseError(l.dnf, offset, "", nil)
+	l.diags = append(l.diags, Diagnostic{
+		Severity: severity,
+		Offset:   offset,
+		Line:     pos.Line,
+		Column:   pos.Column,
+		Msg:      msg,
+	})
+}
+
+// lintAmts reports duplicate keys, empty sets and duplicate values of conj
+func (l *linter) lintAmts(conj *Conjunction) {
+	keys := make(map[string]bool)
+	for _, amt := range conj.Amts {
+		if keys[amt.target()] {
+			l.report(SeverityError, amt.Pos, "conjunction key "+amt.target()+" duplicate")
+		}
+		keys[amt.target()] = true
+
+		if amt.emptySet() && amt.Belong {
+			l.report(SeverityError, amt.Pos, "empty set of key "+amt.Key+" can never be matched")
+		} else if amt.emptySet() {
+			l.report(SeverityWarning, amt.Pos, "empty set of key "+amt.Key+" is always true")
+		}
+
+		vals := make(map[string]bool, len(amt.Vals))
+		for _, val := range amt.Vals {
+			if vals[val] {
+				l.report(SeverityWarning, amt.Pos, "duplicate value "+val+" of key "+amt.Key)
+			}
+			vals[val] = true
+		}
+	}
+}
+
+// lintTerms reports keys and values of conj unknown to the term dictionary of h
+func (l *linter) lintTerms(h *Handler, conj *Conjunction) {
+	h.terms.RLock()
+	keys := make(map[string]bool)
+	for i := range h.terms.terms {
+		keys[h.terms.terms[i].key] = true
+	}
+	h.terms.RUnlock()
+
+	h.termMapLock.RLock()
+	defer h.termMapLock.RUnlock()
+	for _, amt := range conj.Amts {
+		if !keys[amt.Key] {
+			l.report(SeverityWarning, amt.Pos, "key "+amt.Key+" is unknown to the index")
+			continue
+		}
+		kind := valueTerm
+		switch {
+		case amt.Under:
+			kind = underTerm
+		case amt.CIDR, amt.Range != nil, amt.Geo != nil, amt.Week != nil:
+			// values are matched by side indexes
+			continue
+		}
+		for _, val := range amt.Vals {
+			term := &Term{key: amt.Key, val: val, kind: kind}
+			if kind == underTerm {
+				term.val = h.cleanPath(val)
+			}
+			if _, ok := h.termMap[term.mapKey()]; !ok {
+				l.report(SeverityInfo, amt.Pos, "value "+val+" of key "+amt.Key+" is unknown to the index")
+			}
+		}
+	}
+}
+
+// emptySet reports whether amt is a set without values, which is allowed only by the linter
+func (amt *Assignment) emptySet() bool {
+	return len(amt.Vals) == 0 && amt.plainSet()
+}
+
+// alwaysTrue reports whether amt matches any conds, which is not in an empty set
+func (amt *Assignment) alwaysTrue() bool {
+	return !amt.Belong && amt.emptySet()
+}
+
+// subsumes reports whether conjunction a matches any conds matched by conjunction b,
+// each assignment of a must be implied by an assignment of b
+func subsumes(a, b []*Assignment, keyType func(string) KeyType, multi func(string) bool) bool {
+	for _, x := range a {
+		if x.alwaysTrue() {
+			continue
+		}
+		implied := false
+		for _, y := range b {
+			if y.target() == x.target() && implies(y, x, keyType, multi) {
+				implied = true
+				break
+			}
+		}
+		if !implied {
+			return false
+		}
+	}
+	return true
+}
+
+// implies reports whether b matches any conds matched by a, a and b are of the same target,
+// multi tells keys which conds may have several values of, see mergeAmts
+func implies(a, b *Assignment, keyType func(string) KeyType, multi func(string) bool) bool {
+	if a.Exists || b.Exists {
+		switch {
+		case b.Exists && b.Belong:
+			// keys of areas and windows are not in conds
+			return a.Belong && a.Geo == nil && a.Week == nil
+		case b.Exists:
+			return a.Exists && !a.Belong
+		}
+		return a.Exists && !a.Belong && !b.Belong && b.Geo == nil && b.Week == nil
+	}
+	if a.opaque() || b.opaque() {
+		return a.Belong == b.Belong && amtString(a) == amtString(b)
+	}
+
+	if a.Belong != b.Belong {
+		// k in A implies k not in B if A and B are disjoint, unless conds may have other values of k
+		return a.Belong && !isMulti(multi, a.Key) && disjoint(a, b, keyType)
+	}
+
+	t := amtKeyType(a, b, keyType)
+	switch {
+	case a.Range != nil && b.Range != nil:
+		r := a.Range.intersect(t, b.Range)
+		if a.Belong {
+			return r != nil && r.canonical(t) == a.Range.canonical(t)
+		}
+		return r != nil && r.canonical(t) == b.Range.canonical(t)
+	case a.Range != nil:
+		return false
+	case b.Range != nil:
+		if !a.Belong {
+			return false
+		}
+		for _, val := range a.Vals {
+			if x, err := parseBound(t, val); err != nil || !b.Range.contains(t, x) {
+				return false
+			}
+		}
+		return true
+	case a.Belong:
+		return len(filterVals(a.Vals, b.Vals, false)) == 0
+	}
+	return len(filterVals(b.Vals, a.Vals, false)) == 0
+}
+
+// disjoint reports whether no value is in both sets or ranges of a and b
+func disjoint(a, b *Assignment, keyType func(string) KeyType) bool {
+	t := amtKeyType(a, b, keyType)
+	switch {
+	case a.Range != nil && b.Range != nil:
+		return a.Range.intersect(t, b.Range) == nil
+	case a.Range != nil || b.Range != nil:
+		set, r := a, b
+		if a.Range != nil {
+			set, r = b, a
+		}
+		for _, val := range set.Vals {
+			if x, err := parseBound(t, val); err == nil && r.Range.contains(t, x) {
+				return false
+			}
+		}
+		return true
+	}
+	return len(filterVals(a.Vals, b.Vals, true)) == 0
+}
+
+// amtString prints amt with sorted values to compare assignments
+func amtString(amt *Assignment) string {
+	cp := *amt
+	cp.Vals = append([]string(nil), amt.Vals...)
+	sort.Strings(cp.Vals)
+	return DefaultSyntax().printAmt(&cp)
+}
+
+type diagsByOffset []Diagnostic
+
+func (ds diagsByOffset) Len() int           { return len(ds) }
+func (ds diagsByOffset) Less(i, j int) bool { return ds[i].Offset < ds[j].Offset }
+func (ds diagsByOffset) Swap(i, j int)      { ds[i], ds[j] = ds[j], ds[i] }
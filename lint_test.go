@@ -0,0 +1,77 @@
+package godnf_test
+
+import (
+	"strings"
+	"testing"
+
+	dnf "github.com/brg-liuwei/godnf"
+)
+
+func lintString(diags []dnf.Diagnostic) string {
+	ss := make([]string, 0, len(diags))
+	for _, d := range diags {
+		ss = append(ss, d.String())
+	}
+	return strings.Join(ss, "\n")
+}
+
+func TestLintDNF(t *testing.T) {
+	setDelim()
+	for _, c := range []struct {
+		dnf      string
+		expected []string
+	}{
+		{"(region in {SH} and age in [18, 35))", nil},
+		{"(region in {SH} and region not in {SH})", []string{
+			"line 1, column 1: error: conjunction can never be matched",
+			"line 1, column 21: error: conjunction key region duplicate",
+		}},
+		{"(region in {})", []string{
+			"line 1, column 1: error: conjunction can never be matched",
+			"line 1, column 2: error: empty set of key region can never be matched",
+		}},
+		{"(region not in {}) or (age in [18, 35))", []string{
+			"line 1, column 1: warning: conjunction is always true",
+			"line 1, column 2: warning: empty set of key region is always true",
+			"line 1, column 23: warning: conjunction is subsumed by conjunction at line 1, column 1",
+		}},
+		{"(region in {SH, BJ, SH})", []string{
+			"line 1, column 2: warning: duplicate value SH of key region",
+		}},
+		{"(region in {SH} and age > 20) or\n(region in {SH, BJ})", []string{
+			"line 1, column 1: warning: conjunction is subsumed by conjunction at line 2, column 1",
+		}},
+		{"(age in [18, 35)) or (age in [20, 30) and has region) or (age not in [30, 50))", []string{
+			"line 1, column 22: warning: conjunction is subsumed by conjunction at line 1, column 1",
+		}},
+		{"(region in {SH}) or (region in {SH})", []string{
+			"line 1, column 21: warning: conjunction is subsumed by conjunction at line 1, column 1",
+		}},
+		{"(region in {SH}", []string{
+			`line 1, column 16: error: found "EOF", expected "and" or "&&" or ")"`,
+		}},
+	} {
+		got := lintString(dnf.LintDNF(c.dnf, dnf.LintOptions{}))
+		if expected := strings.Join(c.expected, "\n"); got != expected {
+			t.Errorf("diagnostics of %q:\n  got:\n%s\n  expect:\n%s", c.dnf, got, expected)
+		}
+	}
+	syntax := dnf.Syntax{'(', ')', '{', '}', '='}
+	got := lintString(dnf.LintDNF("(region in {SH})", dnf.LintOptions{Syntax: syntax}))
+	if expected := `line 1, column 1: error: invalid syntax: separator of set '=' is a rune of operators =!<>&|`; got != expected {
+		t.Errorf("unexpected diagnostics of invalid syntax: %s", got)
+	}
+}
+
+func TestLintDNFWithHandler(t *testing.T) {
+	h := dnf.NewHandler()
+	if err := h.AddDoc("doc", "0", "(region in {SH, BJ} and age in [18, 35))", attr{0, "doc"}); err != nil {
+		t.Fatal("unexpected error when AddDoc: ", err)
+	}
+	got := lintString(dnf.LintDNF("(regoin in {SH}) or (region in {GZ} and age < 20)", dnf.LintOptions{Handler: h}))
+	expected := "line 1, column 2: warning: key regoin is unknown to the index\n" +
+		"line 1, column 22: info: value GZ of key region is unknown to the index"
+	if got != expected {
+		t.Errorf("unexpected diagnostics:\n%s", got)
+	}
+}
@@ -0,0 +1,133 @@
+package godnf_test
+
+import (
+	"strings"
+	"testing"
+
+	dnf "github.com/brg-liuwei/godnf"
+)
+
+func TestMultiValuedConds(t *testing.T) {
+	setDelim()
+	h := dnf.NewHandler()
+	for i, s := range []string{
+		"(interest in {sports, music} and age in [18, 35))", // docid: 0
+		"(interest in {sports} and app not in {game})",      // docid: 1
+		"(interest in {travel})",                            // docid: 2
+		"(app in {game, video} and region in {SH})",         // docid: 3
+		"(has interest and age in [30, 40))",                // docid: 4
+		"(path under {a/b, a/b/c} and region in {SH})",      // docid: 5
+	} {
+		if err := h.AddDoc("doc", string(rune('0'+i)), s, attr{i, "doc"}); err != nil {
+			t.Fatal("unexpected error when AddDoc: ", err)
+		}
+	}
+
+	for _, c := range []struct {
+		conds    []dnf.Cond
+		expected []int
+	}{
+		{[]dnf.Cond{{"interest", "sports"}, {"interest", "travel"}}, []int{1, 2}},
+		{[]dnf.Cond{{"interest", "sports"}, {"interest", "music"}}, []int{1}},
+		{[]dnf.Cond{{"interest", "sports"}, {"interest", "music"}, {"age", "20"}}, []int{0, 1}},
+		{[]dnf.Cond{{"interest", "sports"}, {"app", "chat"}, {"app", "game"}}, []int{}},
+		{[]dnf.Cond{{"app", "game"}, {"app", "video"}}, []int{}},
+		{[]dnf.Cond{{"app", "game"}, {"app", "video"}, {"region", "SH"}}, []int{3}},
+		{[]dnf.Cond{{"interest", "a"}, {"interest", "b"}}, []int{}},
+		{[]dnf.Cond{{"interest", "a"}, {"age", "31"}, {"age", "50"}}, []int{4}},
+		{[]dnf.Cond{{"age", "20"}, {"age", "31"}, {"interest", "music"}}, []int{0, 4}},
+		{[]dnf.Cond{{"path", "a/b/c/d"}}, []int{}},
+		{[]dnf.Cond{{"path", "a/b/c/d"}, {"region", "SH"}}, []int{5}},
+	} {
+		docs, err := h.SearchAll(c.conds)
+		if err != nil {
+			t.Fatal("unexpected error when Search: ", err)
+		}
+		if !sameDocs(h, docs, c.expected) {
+			t.Errorf("unexpected docs of %v: %v, expect %v", c.conds, docs, c.expected)
+		}
+	}
+
+	if _, err := h.SearchAll([]dnf.Cond{{dnf.GeoLatKey, "31.2"}, {dnf.GeoLatKey, "31.3"}, {dnf.GeoLonKey, "121.4"}}); err == nil {
+		t.Error("expect error when Search with several latitudes")
+	}
+}
+
+func TestMultiValuedCondsSchema(t *testing.T) {
+	h := dnf.NewHandler()
+	err := h.SetSchema(&dnf.Schema{Keys: []dnf.KeySchema{{Key: "interest", Multi: true}, {Key: "region"}}})
+	if err != nil {
+		t.Fatal("unexpected error when SetSchema: ", err)
+	}
+	if _, err := h.SearchAll([]dnf.Cond{{"interest", "sports"}, {"interest", "music"}, {"region", "SH"}}); err != nil {
+		t.Error("unexpected error when Search with several values of a multi-valued key: ", err)
+	}
+	_, err = h.SearchAll([]dnf.Cond{{"region", "SH"}, {"region", "BJ"}})
+	if serr, ok := err.(*dnf.SchemaError); !ok || serr.Kind != dnf.MultipleValuesError {
+		t.Error("expect MultipleValuesError, got ", err)
+	}
+}
+
+func TestMultiValuedBoolExpr(t *testing.T) {
+	setDelim()
+	h := dnf.NewHandler()
+	err := h.SetSchema(&dnf.Schema{Keys: []dnf.KeySchema{
+		{Key: "interest", Multi: true}, {Key: "age", Type: dnf.IntType, Multi: true}, {Key: "region"}}})
+	if err != nil {
+		t.Fatal("unexpected error when SetSchema: ", err)
+	}
+	for i, s := range []string{
+		"interest in {sports, music} and not interest in {music}", // docid: 0
+		"interest in {sports} and interest in {music}",            // docid: 1
+		"age >= 18 and age < 15",                                  // docid: 2
+	} {
+		if err := h.AddBoolExpr("doc", string(rune('0'+i)), s, attr{i, "doc"}); err != nil {
+			t.Fatal("unexpected error when AddBoolExpr: ", err)
+		}
+	}
+	// region has at most one value
+	if err := h.AddBoolExpr("doc", "3", "region in {SH} and region in {BJ}", attr{3, "doc"}); err == nil {
+		t.Error("expect error when AddBoolExpr never matched")
+	}
+
+	for _, c := range []struct {
+		conds    []dnf.Cond
+		expected []int
+	}{
+		{[]dnf.Cond{{"interest", "sports"}}, []int{0}},
+		{[]dnf.Cond{{"interest", "sports"}, {"interest", "music"}}, []int{1}},
+		{[]dnf.Cond{{"interest", "music"}}, []int{}},
+		{[]dnf.Cond{{"age", "10"}, {"age", "20"}}, []int{2}},
+		{[]dnf.Cond{{"age", "20"}}, []int{}},
+	} {
+		docs, err := h.SearchAll(c.conds)
+		if err != nil {
+			t.Fatal("unexpected error when Search: ", err)
+		}
+		if !sameDocs(h, docs, c.expected) {
+			t.Errorf("unexpected docs of %v: %v, expect %v", c.conds, docs, c.expected)
+		}
+	}
+
+	lint := func(s, prefix string) bool {
+		for _, d := range dnf.LintDNF(s, dnf.LintOptions{Handler: h}) {
+			if strings.HasPrefix(d.Msg, prefix) {
+				return true
+			}
+		}
+		return false
+	}
+	if lint("(interest in {sports} and interest in {music})", "conjunction can never be matched") {
+		t.Error("unexpected conjunction never matched of a multi-valued key")
+	}
+	if !lint("(region in {SH} and region in {BJ})", "conjunction can never be matched") {
+		t.Error("expect conjunction never matched of a key of one value")
+	}
+	// conds of sports and music match only the first one
+	if lint("(interest in {sports}) or (interest not in {music})", "conjunction is subsumed") {
+		t.Error("unexpected conjunction subsumed of a multi-valued key")
+	}
+	if !lint("(region in {SH}) or (region not in {BJ})", "conjunction is subsumed") {
+		t.Error("expect conjunction subsumed of a key of one value")
+	}
+}
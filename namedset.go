@@ -0,0 +1,144 @@
+package godnf
+
+import (
+	"errors"
+	"sort"
+)
+
+// RegisterSet registers or replaces a named set of values, which can be referenced
+// by docs like region in @tier1_cities instead of repeating the values inline.
+//
+// A reference is indexed as a single term, and values are looked up in the set at search,
+// so replacing a set takes effect on every doc referencing it at once.
+// Values are normalized and checked by the schema of each key referencing the set,
+// see SetNormalizers and SetSchema
+func (h *Handler) RegisterSet(name string, values []string) error {
+	if name == "" {
+		return errors.New("empty set name")
+	}
+	set := make(map[string]bool, len(values))
+	for _, val := range values {
+		set[val] = true
+	}
+
+	h.setsLock.Lock()
+	defer h.setsLock.Unlock()
+	if schema, schemaKeys := h.getSchema(); schema != nil {
+		keys := make([]string, 0, len(h.setRefs))
+		for key, refs := range h.setRefs {
+			if _, ok := refs[name]; ok {
+				keys = append(keys, key)
+			}
+		}
+		sort.Strings(keys)
+		for _, key := range keys {
+			ks, ok := schemaKeys[key]
+			if !ok {
+				continue
+			}
+			for _, err := range ks.checkVals(sortedVals(h.normalizeSet(key, set), set)) {
+				if err := schema.violation(err); err != nil {
+					return err
+				}
+			}
+		}
+	}
+	h.namedSets[name] = set
+	for key, refs := range h.setRefs {
+		if ref, ok := refs[name]; ok {
+			ref.vals = h.normalizeSet(key, set)
+		}
+	}
+	return nil
+}
+
+// setRef is a reference to a named set by a key
+type setRef struct {
+	termId int
+	vals   map[string]bool // values of the set normalized for the key, nil if the key has no normalizers
+}
+
+// normalizeSet returns values of set normalized by the normalizers of key, or nil if there are none
+func (h *Handler) normalizeSet(key string, set map[string]bool) map[string]bool {
+	if len(h.normalizersOf(key)) == 0 {
+		return nil
+	}
+	vals := make(map[string]bool, len(set))
+	for val := range set {
+		vals[h.normalizeVal(key, val)] = true
+	}
+	return vals
+}
+
+// sortedVals returns sorted values of normalized, or of set if normalized is nil
+func sortedVals(normalized, set map[string]bool) []string {
+	if normalized == nil {
+		normalized = set
+	}
+	vals := make([]string, 0, len(normalized))
+	for val := range normalized {
+		vals = append(vals, val)
+	}
+	sort.Strings(vals)
+	return vals
+}
+
+// setValues returns sorted values of set name normalized for key
+func (h *Handler) setValues(key, name string) []string {
+	h.setsLock.RLock()
+	defer h.setsLock.RUnlock()
+	set := h.namedSets[name]
+	return sortedVals(h.normalizeSet(key, set), set)
+}
+
+// namedSetCheck returns an error if expr references unregistered sets
+func (h *Handler) namedSetCheck(expr *Expr) error {
+	h.setsLock.RLock()
+	defer h.setsLock.RUnlock()
+	for _, conj := range expr.Conjs {
+		for _, amt := range conj.Amts {
+			if amt.NamedSet == "" {
+				continue
+			}
+			if _, ok := h.namedSets[amt.NamedSet]; !ok {
+				return errors.New("set " + amt.NamedSet + " not registered")
+			}
+		}
+	}
+	return nil
+}
+
+// namedSetIndexAdd indexes the reference to set name by key
+func (h *Handler) namedSetIndexAdd(key, name string, termId int) {
+	h.setsLock.Lock()
+	defer h.setsLock.Unlock()
+	refs, ok := h.setRefs[key]
+	if !ok {
+		refs = make(map[string]*setRef)
+		h.setRefs[key] = refs
+	}
+	if _, ok := refs[name]; !ok {
+		refs[name] = &setRef{termId: termId, vals: h.normalizeSet(key, h.namedSets[name])}
+	}
+}
+
+// namedSetLookup appends ids of references to sets containing values of conds to termids
+func (h *Handler) namedSetLookup(conds []Cond, termids []int) []int {
+	h.setsLock.RLock()
+	defer h.setsLock.RUnlock()
+	if len(h.setRefs) == 0 {
+		return termids
+	}
+	for i := range conds {
+		for name, ref := range h.setRefs[conds[i].Key] {
+			vals := ref.vals
+			if vals == nil {
+				vals = h.namedSets[name]
+			}
+			if vals[conds[i].Val] {
+				termids = append(termids, ref.termId)
+			}
+		}
+	}
+	return termids
+}
@@ -0,0 +1,141 @@
+package godnf_test
+
+import (
+	"strings"
+	"testing"
+
+	dnf "github.com/brg-liuwei/godnf"
+)
+
+func TestParseNamedSet(t *testing.T) {
+	setDelim()
+	for _, c := range []struct {
+		dnf      string
+		expected string
+	}{
+		{"(region in @tier1_cities)", "(region in @tier1_cities)"},
+		{"(region not in @\"tier 1\" and app in {x})", "(region not in @\"tier 1\" and app in {x})"},
+	} {
+		expr, err := dnf.ParseDNF(c.dnf)
+		if err != nil {
+			t.Errorf("unexpected error when ParseDNF %q: %v", c.dnf, err)
+			continue
+		}
+		if got := expr.String(); got != c.expected {
+			t.Errorf("unexpected dnf of %q: %s", c.dnf, got)
+		}
+	}
+
+	for _, s := range []string{
+		"(region in @)",
+		"(region under @tier1)",
+		"(region in @tier1 and region in {x})",
+	} {
+		if err := dnf.DnfCheck(s); err == nil {
+			t.Error("expect error when DnfCheck: ", s)
+		}
+	}
+
+	b, err := dnf.DNFToJSON("(region in @tier1 and app not in @blocked)")
+	if err != nil {
+		t.Fatal("unexpected error when DNFToJSON: ", err)
+	}
+	if string(b) != `{"or":[{"and":[{"key":"region","in_set":"tier1"},{"key":"app","not_in_set":"blocked"}]}]}` {
+		t.Error("unexpected json: ", string(b))
+	}
+	if s, err := dnf.JSONToDNF(b); err != nil || s != "(region in @tier1 and app not in @blocked)" {
+		t.Error("unexpected dnf from json: ", s, err)
+	}
+}
+
+func TestNamedSetRetrieval(t *testing.T) {
+	h := dnf.NewHandler()
+	if err := h.AddDoc("doc", "0", "(region in @tier1)", attr{0, "doc"}); err == nil {
+		t.Error("expect error when AddDoc referencing unregistered set")
+	}
+	if err := h.RegisterSet("tier1", []string{"SH", "BJ"}); err != nil {
+		t.Fatal("unexpected error when RegisterSet: ", err)
+	}
+	if err := h.RegisterSet("blocked", []string{"a"}); err != nil {
+		t.Fatal("unexpected error when RegisterSet: ", err)
+	}
+	for i, s := range []string{
+		"(region in @tier1)",                         // docid: 0
+		"(region in @tier1 and app not in @blocked)", // docid: 1
+		"(region in {GZ} and app not in @blocked)",   // docid: 2
+	} {
+		if err := h.AddDoc("doc", string(rune('0'+i)), s, attr{i, "doc"}); err != nil {
+			t.Fatal("unexpected error when AddDoc: ", err)
+		}
+	}
+
+	check := func(conds []dnf.Cond, expected []int) {
+		docs, err := h.SearchAll(conds)
+		if err != nil {
+			t.Fatal("unexpected error when Search: ", err)
+		}
+		if !sameDocs(h, docs, expected) {
+			t.Errorf("unexpected docs of %v: %v, expect %v", conds, docs, expected)
+		}
+	}
+	check([]dnf.Cond{{"region", "SH"}}, []int{0, 1})
+	check([]dnf.Cond{{"region", "SH"}, {"app", "a"}}, []int{0})
+	check([]dnf.Cond{{"region", "GZ"}, {"app", "b"}}, []int{2})
+	check([]dnf.Cond{{"region", "GZ"}, {"app", "a"}}, []int{})
+
+	// replacing sets takes effect on docs referencing them
+	if err := h.RegisterSet("tier1", []string{"BJ", "GZ"}); err != nil {
+		t.Fatal("unexpected error when RegisterSet: ", err)
+	}
+	if err := h.RegisterSet("blocked", nil); err != nil {
+		t.Fatal("unexpected error when RegisterSet: ", err)
+	}
+	check([]dnf.Cond{{"region", "SH"}}, []int{})
+	check([]dnf.Cond{{"region", "GZ"}, {"app", "a"}}, []int{0, 1, 2})
+
+	if dump := string(h.DumpById()); !strings.Contains(dump, "@tier1") || strings.Contains(dump, "BJ") {
+		t.Error("expect references to sets in dump: ", dump)
+	}
+}
+
+func TestNamedSetNormalized(t *testing.T) {
+	h := dnf.NewHandler()
+	h.SetNormalizers("city", dnf.TrimSpace, dnf.Lowercase)
+	if err := h.RegisterSet("cities", []string{"Beijing", " ShangHai "}); err != nil {
+		t.Fatal("unexpected error when RegisterSet: ", err)
+	}
+	for i, s := range []string{
+		"(city in @cities)",   // docid: 0
+		"(region in @cities)", // docid: 1
+	} {
+		if err := h.AddDoc("doc", string(rune('0'+i)), s, attr{i, "doc"}); err != nil {
+			t.Fatal("unexpected error when AddDoc: ", err)
+		}
+	}
+
+	for _, c := range []struct {
+		conds    []dnf.Cond
+		expected []int
+	}{
+		{[]dnf.Cond{{"city", "Beijing"}}, []int{0}},
+		{[]dnf.Cond{{"city", "shanghai"}}, []int{0}},
+		{[]dnf.Cond{{"region", "Beijing"}}, []int{1}},
+		{[]dnf.Cond{{"region", "beijing"}}, []int{}},
+	} {
+		docs, err := h.SearchAll(c.conds)
+		if err != nil {
+			t.Fatal("unexpected error when Search: ", err)
+		}
+		if !sameDocs(h, docs, c.expected) {
+			t.Errorf("unexpected docs of %v: %v, expect %v", c.conds, docs, c.expected)
+		}
+	}
+
+	// values of replaced sets are normalized too
+	if err := h.RegisterSet("cities", []string{"GuangZhou"}); err != nil {
+		t.Fatal("unexpected error when RegisterSet: ", err)
+	}
+	if docs, _ := h.SearchAll([]dnf.Cond{{"city", "GUANGZHOU"}}); !sameDocs(h, docs, []int{0}) {
+		t.Error("unexpected docs after RegisterSet: ", docs)
+	}
+}
@@ -0,0 +1,202 @@
+package godnf
+
+import (
+	"bufio"
+	"errors"
+	"os"
+	"strconv"
+	"strings"
+
+	"golang.org/x/text/unicode/norm"
+)
+
+// Normalizer normalizes values of a key, see Handler.SetNormalizers
+type Normalizer interface {
+	Normalize(val string) string
+}
+
+// NormalizerFunc is a function used as a Normalizer
+type NormalizerFunc func(val string) string
+
+func (f NormalizerFunc) Normalize(val string) string {
+	return f(val)
+}
+
+var (
+	Lowercase Normalizer = NormalizerFunc(strings.ToLower)   // ShangHai --> shanghai
+	TrimSpace Normalizer = NormalizerFunc(strings.TrimSpace) // " SH " --> SH
+	NFC       Normalizer = NormalizerFunc(norm.NFC.String)   // Unicode normalization form C
+)
+
+// aliases maps aliases to their canonical values
+type aliases map[string]string
+
+func (a aliases) Normalize(val string) string {
+	if canonical, ok := a[val]; ok {
+		return canonical
+	}
+	return val
+}
+
+// NewAliases returns a Normalizer which replaces aliases by their canonical values:
+//
+//	dnf.NewAliases(map[string]string{"shanghai": "SH", "sh": "SH"})
+func NewAliases(m map[string]string) Normalizer {
+	a := make(aliases, len(m))
+	for alias, canonical := range m {
+		a[alias] = canonical
+	}
+	return a
+}
+
+// LoadAliases loads aliases from the file of path, each line is a canonical value and its aliases:
+//
+//	# cities
+//	SH = shanghai, shang hai
+//	BJ = beijing, peking
+//
+// values are trimmed and can not have commas or equal signs, blank lines and lines starting with '#' are ignored
+func LoadAliases(path string) (Normalizer, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	a := make(aliases)
+	scanner := bufio.NewScanner(f)
+	for n := 1; scanner.Scan(); n++ {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		canonical, names, err := parseAliasLine(line)
+		if err != nil {
+			return nil, errors.New(path + ":" + strconv.Itoa(n) + ": " + err.Error())
+		}
+		for _, name := range names {
+			if old, ok := a[name]; ok && old != canonical {
+				return nil, errors.New(path + ":" + strconv.Itoa(n) + ": alias " + name + " of both " + old + " and " + canonical)
+			}
+			a[name] = canonical
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	return a, nil
+}
+
+// parseAliasLine parses CANONICAL = ALIAS, ALIAS
+func parseAliasLine(line string) (canonical string, names []string, err error) {
+	i := strings.IndexByte(line, '=')
+	if i < 0 {
+		return "", nil, errors.New("expect = in " + strconv.Quote(line))
+	}
+	if canonical = strings.TrimSpace(line[:i]); canonical == "" {
+		return "", nil, errors.New("empty canonical value")
+	}
+	for _, name := range strings.Split(line[i+1:], ",") {
+		if name = strings.TrimSpace(name); name == "" {
+			return "", nil, errors.New("empty alias of " + canonical)
+		}
+		names = append(names, name)
+	}
+	return canonical, names, nil
+}
+
+// SetNormalizers set the chain of normalizers of values of key, which are applied in order
+// to values of docs and conds, it must be called before adding docs and setting a taxonomy,
+// or an error is returned:
+//
+//	h.SetNormalizers("city", dnf.TrimSpace, dnf.Lowercase, aliases)
+//	h.AddDoc("ad0", "0", "(city in {ShangHai})", attr) // indexed as city in {SH}
+//	h.Search([]dnf.Cond{{"city", " shanghai "}}, filter) // ad0 is found
+func (h *Handler) SetNormalizers(key string, normalizers ...Normalizer) error {
+	if h.GetDocSize() != 0 {
+		return errors.New("normalizers can not be set after docs are added")
+	}
+	h.confLock.Lock()
+	defer h.confLock.Unlock()
+	if h.taxonomy != nil {
+		// values of the taxonomy are normalized by SetTaxonomy
+		return errors.New("normalizers can not be set after a taxonomy is set")
+	}
+	if len(normalizers) == 0 {
+		delete(h.normalizers, key)
+		return nil
+	}
+	h.normalizers[key] = append([]Normalizer(nil), normalizers...)
+	return nil
+}
+
+// normalizersOf returns the chain of normalizers of key
+func (h *Handler) normalizersOf(key string) []Normalizer {
+	h.confLock.RLock()
+	defer h.confLock.RUnlock()
+	return h.normalizers[key]
+}
+
+// hasNormalizers reports whether any key has normalizers
+func (h *Handler) hasNormalizers() bool {
+	h.confLock.RLock()
+	defer h.confLock.RUnlock()
+	return len(h.normalizers) != 0
+}
+
+// normalizeVal returns val normalized by the normalizers of key
+func (h *Handler) normalizeVal(key, val string) string {
+	for _, n := range h.normalizersOf(key) {
+		val = n.Normalize(val)
+	}
+	return val
+}
+
+// normalize returns expr with values of sets and paths normalized, or expr itself if nothing changes,
+// normalized values are deduplicated
+func (h *Handler) normalize(expr *Expr) *Expr {
+	if !h.hasNormalizers() {
+		return expr
+	}
+	changed := false
+	rc := &Expr{Conjs: make([]*Conjunction, 0, len(expr.Conjs))}
+	for _, conj := range expr.Conjs {
+		c := &Conjunction{Pos: conj.Pos, Amts: make([]*Assignment, 0, len(conj.Amts))}
+		for _, amt := range conj.Amts {
+			if len(h.normalizersOf(amt.Key)) == 0 || !amt.plainSet() || amt.CIDR {
+				c.Amts = append(c.Amts, amt)
+				continue
+			}
+			cp := *amt
+			cp.Vals = make([]string, 0, len(amt.Vals))
+			seen := make(map[string]bool, len(amt.Vals))
+			for _, val := range amt.Vals {
+				norm := h.normalizeVal(amt.Key, val)
+				changed = changed || norm != val
+				if !seen[norm] {
+					seen[norm] = true
+					cp.Vals = append(cp.Vals, norm)
+				}
+			}
+			changed = changed || len(cp.Vals) != len(amt.Vals)
+			c.Amts = append(c.Amts, &cp)
+		}
+		rc.Conjs = append(rc.Conjs, c)
+	}
+	if !changed {
+		return expr
+	}
+	return rc
+}
+
+// normalizeConds returns conds with normalized values, or conds itself if there are no normalizers
+func (h *Handler) normalizeConds(conds []Cond) []Cond {
+	if !h.hasNormalizers() {
+		return conds
+	}
+	rc := make([]Cond, len(conds))
+	for i := range conds {
+		rc[i] = Cond{Key: conds[i].Key, Val: h.normalizeVal(conds[i].Key, conds[i].Val)}
+	}
+	return rc
+}
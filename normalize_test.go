@@ -0,0 +1,110 @@
+package godnf_test
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"testing"
+
+	dnf "github.com/brg-liuwei/godnf"
+)
+
+func TestNFC(t *testing.T) {
+	for _, c := range []struct {
+		s        string
+		expected string
+	}{
+		{"Shanghai", "Shanghai"},
+		{"Cafe\u0301", "Caf\u00e9"},
+		{"Caf\u00e9", "Caf\u00e9"},
+		{"A\u030a", "\u00c5"},
+		{"\u212b", "\u00c5"},               // angstrom sign is a singleton
+		{"q\u0307\u0323", "q\u0323\u0307"}, // marks are reordered
+		{"d\u0307\u0323", "\u1e0d\u0307"},  // d with dot below and dot above
+		{"\u1100\u1161\u11a8", "\uac01"},   // hangul jamo
+		{"\u0915\u093c", "\u0915\u093c"},   // composition exclusion
+		{"\u304b\u3099", "\u304c"},         // ka with voiced sound mark
+		{"e\u0301\u0301", "\u00e9\u0301"},  // the second mark is blocked
+	} {
+		if got := dnf.NFC.Normalize(c.s); got != c.expected {
+			t.Errorf("NFC of %+q: got %+q, expect %+q", c.s, got, c.expected)
+		}
+	}
+}
+
+func TestLoadAliases(t *testing.T) {
+	f, err := ioutil.TempFile("", "aliases")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.Remove(f.Name())
+	f.WriteString("# cities\n\nSH = shanghai, shang hai\nBJ= beijing ,peking\n")
+	f.Close()
+
+	aliases, err := dnf.LoadAliases(f.Name())
+	if err != nil {
+		t.Fatal("unexpected error when LoadAliases: ", err)
+	}
+	for val, expected := range map[string]string{"shanghai": "SH", "shang hai": "SH", "peking": "BJ", "GZ": "GZ", "SH": "SH"} {
+		if got := aliases.Normalize(val); got != expected {
+			t.Errorf("alias of %q: got %q, expect %q", val, got, expected)
+		}
+	}
+
+	for _, s := range []string{"SH shanghai\n", "SH = a,,b\n", "= a\n", "SH = a\nBJ = a\n"} {
+		ioutil.WriteFile(f.Name(), []byte(s), 0644)
+		if _, err := dnf.LoadAliases(f.Name()); err == nil {
+			t.Errorf("expect error when LoadAliases %q", s)
+		}
+	}
+	if _, err := dnf.LoadAliases(f.Name() + ".missing"); err == nil {
+		t.Error("expect error when LoadAliases a missing file")
+	}
+}
+
+func TestNormalizers(t *testing.T) {
+	setDelim()
+	h := dnf.NewHandler()
+	h.SetNormalizers("city", dnf.TrimSpace, dnf.NFC, dnf.Lowercase,
+		dnf.NewAliases(map[string]string{"shanghai": "sh", "beijing": "bj"}))
+	h.SetNormalizers("os", dnf.Lowercase)
+	for i, s := range []string{
+		"(city in {ShangHai, SH} and os not in {IOS})", // docid: 0
+		"(city in {\" Beijing \"})",                    // docid: 1
+		"(city in {Montre\u0301al})",                   // docid: 2
+	} {
+		if err := h.AddDoc("doc", string(rune('0'+i)), s, attr{i, "doc"}); err != nil {
+			t.Fatal("unexpected error when AddDoc: ", err)
+		}
+	}
+
+	for _, c := range []struct {
+		conds    []dnf.Cond
+		expected []int
+	}{
+		{[]dnf.Cond{{"city", " shanghai "}}, []int{0}},
+		{[]dnf.Cond{{"city", "SH"}, {"os", "iOS"}}, []int{}},
+		{[]dnf.Cond{{"city", "BEIJING"}}, []int{1}},
+		{[]dnf.Cond{{"city", "montr\u00e9al"}}, []int{2}},
+	} {
+		docs, err := h.SearchAll(c.conds)
+		if err != nil {
+			t.Fatal("unexpected error when Search: ", err)
+		}
+		if !sameDocs(h, docs, c.expected) {
+			t.Errorf("unexpected docs of %v: %v, expect %v", c.conds, docs, c.expected)
+		}
+	}
+	if err := h.SetNormalizers("region", dnf.Lowercase); err == nil {
+		t.Error("expect error when SetNormalizers after docs are added")
+	}
+
+	var m map[string]map[string]interface{}
+	json.Unmarshal(h.DumpByDocId(), &m)
+	if m["0"]["dnf"] != "(city in {ShangHai, SH} and os not in {IOS})" {
+		t.Error("unexpected dnf of dump: ", m["0"]["dnf"])
+	}
+	if m["0"]["normalized_dnf"] != "(city in {sh} and os not in {ios})" {
+		t.Error("unexpected normalized_dnf of dump: ", m["0"]["normalized_dnf"])
+	}
+}
@@ -0,0 +1,503 @@
+package godnf
+
+import (
+	"errors"
+	"net"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Overlaps reports whether some conds match both dnf a and b, like a request two campaigns compete for,
+// and returns such conds as witness. Conds are supposed to have at most one value of each key,
+// see OverlapsWithOptions for keys of several values,
+// and if a or b has time windows, the witness matches them at some time in the windows.
+// An error is returned if no witness is found but the dnfs may still overlap, like circles in rare layouts.
+//
+// Dnfs are parsed with the default syntax and indexed like AddDoc, so polygons and named sets
+// can not be referenced, and ranges are compared as versions if any bound is not a number
+func Overlaps(a, b string) (bool, []Cond, error) {
+	return OverlapsWithOptions(a, b, OverlapOptions{})
+}
+
+// OverlapOptions are options of OverlapsWithOptions and EquivalentWithOptions
+type OverlapOptions struct {
+	// Schema, if not nil, declares keys which conds may have several values of, see KeySchema.Multi,
+	// an `in` of such a key is satisfied by any value and a `not in` is violated by any value
+	Schema *Schema
+}
+
+// OverlapsWithOptions reports whether some conds match both dnf a and b like Overlaps with opts
+func OverlapsWithOptions(a, b string, opts OverlapOptions) (bool, []Cond, error) {
+	an, err := newAnalyzer(a, b, opts)
+	if err != nil {
+		return false, nil, err
+	}
+	and := &BoolExpr{Op: BoolAnd, Args: []*BoolExpr{an.a.boolExpr(), an.b.boolExpr()}}
+	return an.find(and, true, true)
+}
+
+// Equivalent reports whether dnf a and b match the same conds, like an edit which does not change targeting,
+// and returns conds matching only one of them as witness if they are not equivalent, see Overlaps
+func Equivalent(a, b string) (bool, []Cond, error) {
+	return EquivalentWithOptions(a, b, OverlapOptions{})
+}
+
+// EquivalentWithOptions reports whether dnf a and b match the same conds like Equivalent with opts
+func EquivalentWithOptions(a, b string, opts OverlapOptions) (bool, []Cond, error) {
+	an, err := newAnalyzer(a, b, opts)
+	if err != nil {
+		return false, nil, err
+	}
+	onlyA := &BoolExpr{Op: BoolAnd, Args: []*BoolExpr{an.a.boolExpr(), {Op: BoolNot, Args: []*BoolExpr{an.b.boolExpr()}}}}
+	if found, witness, err := an.find(onlyA, true, false); err != nil || found {
+		return false, witness, err
+	}
+	onlyB := &BoolExpr{Op: BoolAnd, Args: []*BoolExpr{{Op: BoolNot, Args: []*BoolExpr{an.a.boolExpr()}}, an.b.boolExpr()}}
+	if found, witness, err := an.find(onlyB, false, true); err != nil || found {
+		return false, witness, err
+	}
+	return true, nil, nil
+}
+
+// boolExpr returns the BoolExpr of expr
+func (expr *Expr) boolExpr() *BoolExpr {
+	or := &BoolExpr{Op: BoolOr}
+	for _, conj := range expr.Conjs {
+		and := &BoolExpr{Pos: conj.Pos, Op: BoolAnd}
+		for _, amt := range conj.Amts {
+			and.Args = append(and.Args, &BoolExpr{Pos: amt.Pos, Op: BoolAmt, Amt: amt})
+		}
+		or.Args = append(or.Args, and)
+	}
+	return or
+}
+
+// analyzer indexes dnf a and b in a handler to verify witnesses
+type analyzer struct {
+	h     *Handler
+	a, b  *Expr
+	multi map[string]bool // keys which conds may have several values of
+}
+
+type analyzedDoc string
+
+func (doc analyzedDoc) ToString() string {
+	return string(doc)
+}
+
+func (doc analyzedDoc) ToMap() map[string]interface{} {
+	return map[string]interface{}{"doc": string(doc)}
+}
+
+func newAnalyzer(a, b string, opts OverlapOptions) (*analyzer, error) {
+	an := &analyzer{h: NewHandlerWithoutLock(), multi: make(map[string]bool)}
+	if opts.Schema != nil {
+		for _, ks := range opts.Schema.Keys {
+			an.multi[ks.Key] = ks.Multi
+		}
+	}
+	var err error
+	if an.a, err = ParseDNF(a); err != nil {
+		return nil, err
+	}
+	if an.b, err = ParseDNF(b); err != nil {
+		return nil, err
+	}
+	for _, expr := range []*Expr{an.a, an.b} {
+		for _, conj := range expr.Conjs {
+			for _, amt := range conj.Amts {
+				if amt.Range != nil && amt.Bucket == nil && amt.Range.keyType() == VersionKey {
+					an.h.SetKeyType(amt.Key, VersionKey)
+				}
+			}
+		}
+	}
+	if err := an.h.AddDoc("a", "a", a, analyzedDoc("a")); err != nil {
+		return nil, err
+	}
+	if err := an.h.AddDoc("b", "b", b, analyzedDoc("b")); err != nil {
+		return nil, err
+	}
+	return an, nil
+}
+
+// find returns conds matching a iff matchA and b iff matchB, candidates are built from conjunctions of expr,
+// an error is returned if none is found but some conjunction can not be decided
+func (an *analyzer) find(expr *BoolExpr, matchA, matchB bool) (bool, []Cond, error) {
+	multi := func(key string) bool { return an.multi[key] }
+	conjs, err := expr.dnf(false, DefaultMaxConjunctions, an.h.KeyType, multi)
+	if err != nil {
+		return false, nil, err
+	}
+	var undecided error
+	for _, amts := range conjs {
+		conds, t, ok, err := an.witness(amts)
+		if err != nil {
+			undecided = err
+		}
+		if !ok {
+			continue
+		}
+		search := conds
+		if len(search) == 0 {
+			// a request without any key, searched by a key of no term
+			search = []Cond{{Key: "\x00"}}
+		}
+		docs, err := an.h.SearchWithOptions(search, func(DocAttr) bool { return true }, SearchOptions{Time: t})
+		if err != nil {
+			return false, nil, err
+		}
+		matched := make(map[string]bool, 2)
+		for _, doc := range docs {
+			attr, _ := an.h.DocId2Attr(doc)
+			matched[attr.ToString()] = true
+		}
+		if matched["a"] == matchA && matched["b"] == matchB {
+			return true, conds, nil
+		}
+	}
+	return false, nil, undecided
+}
+
+// witness returns conds and time which may match the conjunction amts,
+// or an error if it can not be decided whether there are any
+func (an *analyzer) witness(amts []*Assignment) ([]Cond, time.Time, bool, error) {
+	byKey := make(map[string][]*Assignment)
+	var geos, weeks []*Assignment
+	for _, amt := range amts {
+		switch {
+		case amt.Geo != nil:
+			geos = append(geos, amt)
+		case amt.Week != nil:
+			weeks = append(weeks, amt)
+		default:
+			byKey[amt.Key] = append(byKey[amt.Key], amt)
+		}
+	}
+
+	keys := make([]string, 0, len(byKey))
+	for key := range byKey {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	var conds []Cond
+	for _, key := range keys {
+		if an.multi[key] {
+			vals, ok := an.values(byKey[key])
+			if !ok {
+				return nil, time.Time{}, false, nil
+			}
+			for _, val := range vals {
+				conds = append(conds, Cond{Key: key, Val: val})
+			}
+			continue
+		}
+		val, present, ok := an.value(byKey[key])
+		if !ok {
+			return nil, time.Time{}, false, nil
+		}
+		if present {
+			conds = append(conds, Cond{Key: key, Val: val})
+		}
+	}
+
+	pt, ok, err := geoWitness(geos)
+	if !ok {
+		return nil, time.Time{}, false, err
+	}
+	if pt != nil {
+		conds = append(conds, Cond{Key: GeoLatKey, Val: strconv.FormatFloat(pt.Lat, 'g', -1, 64)},
+			Cond{Key: GeoLonKey, Val: strconv.FormatFloat(pt.Lon, 'g', -1, 64)})
+	}
+
+	t, ok := weekWitness(weeks)
+	return conds, t, ok, nil
+}
+
+// maxBucketCandidates is the number of values tried to fall into a range of buckets
+const maxBucketCandidates = 1 << 16
+
+// value returns a value satisfying amts of a key, or present is false if the key should not be in conds
+func (an *analyzer) value(amts []*Assignment) (val string, present, ok bool) {
+	positive := false
+	for _, amt := range amts {
+		if amt.Exists && !amt.Belong {
+			return "", false, true
+		}
+		positive = positive || amt.Belong
+	}
+	if !positive {
+		return "", false, true
+	}
+
+	candidates := an.candidates(amts)
+	for i := 0; i < len(candidates) || i < maxBucketCandidates; i++ {
+		val := strconv.Itoa(i)
+		if i < len(candidates) {
+			val = candidates[i]
+		} else if !hasBucket(amts) {
+			break
+		}
+		ok := true
+		for _, amt := range amts {
+			ok = ok && an.matchVal(amt, val)
+		}
+		if ok {
+			return val, true, true
+		}
+	}
+	return "", false, false
+}
+
+// values returns values of a multi-valued key satisfying amts, a value for each `in` which is in no `not in`,
+// or no values if the key should not be in conds
+func (an *analyzer) values(amts []*Assignment) (vals []string, ok bool) {
+	var positives, negatives []*Assignment
+	for _, amt := range amts {
+		switch {
+		case amt.Exists && !amt.Belong:
+			return nil, true
+		case amt.Belong:
+			positives = append(positives, amt)
+		default:
+			negatives = append(negatives, amt)
+		}
+	}
+	if len(positives) == 0 {
+		return nil, true
+	}
+
+	candidates := an.candidates(amts)
+	for _, pos := range positives {
+		found := false
+		for _, val := range vals {
+			found = found || an.matchVal(pos, val)
+		}
+		for i := 0; !found && (i < len(candidates) || i < maxBucketCandidates); i++ {
+			val := strconv.Itoa(i)
+			if i < len(candidates) {
+				val = candidates[i]
+			} else if !hasBucket(amts) {
+				break
+			}
+			found = an.matchVal(pos, val)
+			for _, neg := range negatives {
+				found = found && an.matchVal(neg, val)
+			}
+			if found {
+				vals = append(vals, val)
+			}
+		}
+		if !found {
+			return nil, false
+		}
+	}
+	return vals, true
+}
+
+func hasBucket(amts []*Assignment) bool {
+	for _, amt := range amts {
+		if amt.Bucket != nil {
+			return true
+		}
+	}
+	return false
+}
+
+// candidates returns values in and around values, paths, prefixes and ranges of amts
+func (an *analyzer) candidates(amts []*Assignment) []string {
+	var candidates []string
+	seen := make(map[string]bool)
+	add := func(val string) {
+		if !seen[val] {
+			seen[val] = true
+			candidates = append(candidates, val)
+		}
+	}
+
+	var nums []float64
+	for _, amt := range amts {
+		for _, val := range amt.Vals {
+			add(val)
+			if amt.Under {
+				// a descendant of path
+				add(an.h.cleanPath(val) + an.h.pathSeparator() + "x")
+			}
+			if _, ipnet, err := net.ParseCIDR(val); amt.CIDR && err == nil {
+				// the first and the last address of prefix
+				last := make(net.IP, len(ipnet.IP))
+				for i := range last {
+					last[i] = ipnet.IP[i] | ^ipnet.Mask[i]
+				}
+				add(ipnet.IP.String())
+				add(last.String())
+			}
+		}
+		if amt.Range == nil || amt.Bucket != nil {
+			continue
+		}
+		for _, s := range []string{amt.Range.Min, amt.Range.Max} {
+			if s == "" {
+				continue
+			}
+			add(s)
+			if x, err := parseNumber(s); err == nil {
+				nums = append(nums, x)
+			} else {
+				// a version just above s
+				add(s + ".1")
+			}
+		}
+	}
+
+	for i, x := range nums {
+		add(strconv.FormatFloat(x-1, 'g', -1, 64))
+		add(strconv.FormatFloat(x+1, 'g', -1, 64))
+		for _, y := range nums[i+1:] {
+			add(strconv.FormatFloat((x+y)/2, 'g', -1, 64))
+		}
+	}
+	add("0")
+
+	// a value different from all others
+	fresh := "?"
+	for seen[fresh] {
+		fresh += "?"
+	}
+	return append(candidates, fresh)
+}
+
+// matchVal reports whether a cond of val satisfies amt
+func (an *analyzer) matchVal(amt *Assignment, val string) bool {
+	in := false
+	switch {
+	case amt.Exists:
+		in = true
+	case amt.Bucket != nil:
+		in = amt.Range.contains(NumberKey, number(BucketOf(val, amt.Bucket.Mod, amt.Bucket.Salt)))
+	case amt.Range != nil:
+		t := an.h.KeyType(amt.Key)
+		x, err := parseBound(t, val)
+		in = err == nil && amt.Range.contains(t, x)
+	case amt.Under:
+		path, sep := an.h.cleanPath(val), an.h.pathSeparator()
+		for _, v := range amt.Vals {
+			v = an.h.cleanPath(v)
+			in = in || path == v || strings.HasPrefix(path, v+sep)
+		}
+	case amt.CIDR:
+		ip := net.ParseIP(val)
+		for _, v := range amt.Vals {
+			_, ipnet, err := net.ParseCIDR(v)
+			in = in || (ip != nil && err == nil && ipnet.Contains(ip))
+		}
+	default:
+		for _, v := range amt.Vals {
+			in = in || v == val
+		}
+	}
+	return in == amt.Belong
+}
+
+// geoWitness returns a location satisfying geo predicates, or nil if there is no location in conds.
+// Locations tried are centres of circles, points between them and points just out of excluded circles,
+// an error is returned if none of them satisfies the predicates but some location still may
+func geoWitness(geos []*Assignment) (pt *GeoPoint, ok bool, err error) {
+	var positives, negatives []*geoCircle
+	for _, amt := range geos {
+		if amt.Belong {
+			positives = append(positives, amt.Geo.circle())
+		} else {
+			negatives = append(negatives, amt.Geo.circle())
+		}
+	}
+	if len(positives) == 0 {
+		return nil, true, nil
+	}
+
+	var candidates []GeoPoint
+	add := func(lat, lon float64) {
+		candidates = append(candidates, GeoPoint{Lat: lat, Lon: lon})
+	}
+	for i, p := range positives {
+		add(p.lat, p.lon)
+		for _, q := range positives[i+1:] {
+			d := geoDistance(p.lat, p.lon, q.lat, q.lon)
+			// the middle of the overlap of both circles on the line between centres
+			add(geoToward(p.lat, p.lon, q.lat, q.lon, (d+p.radius-q.radius)/2))
+			for k := 1; k < 16; k++ {
+				add(geoToward(p.lat, p.lon, q.lat, q.lon, d*float64(k)/16))
+			}
+		}
+		for _, n := range negatives {
+			// just out of n towards the centre of p, and the edge of p away from n
+			add(geoToward(n.lat, n.lon, p.lat, p.lon, n.radius*1.001+1))
+			add(geoToward(p.lat, p.lon, n.lat, n.lon, -p.radius*0.999))
+		}
+	}
+
+	for _, c := range candidates {
+		ok := true
+		for _, amt := range geos {
+			ok = ok && amt.Geo.circle().contains(c.Lat, c.Lon) == amt.Belong
+		}
+		if ok {
+			return &GeoPoint{Lat: c.Lat, Lon: c.Lon}, true, nil
+		}
+	}
+
+	// no location if two circles are apart, or a circle is in an excluded one
+	for i, p := range positives {
+		for _, q := range positives[i+1:] {
+			if geoDistance(p.lat, p.lon, q.lat, q.lon) > p.radius+q.radius {
+				return nil, false, nil
+			}
+		}
+		for _, n := range negatives {
+			if geoDistance(n.lat, n.lon, p.lat, p.lon)+p.radius <= n.radius {
+				return nil, false, nil
+			}
+		}
+	}
+	return nil, false, errors.New("overlap of geo areas can not be decided")
+}
+
+// weekWitness returns a time satisfying time windows of weeks
+func weekWitness(weeks []*Assignment) (time.Time, bool) {
+	// 2024-01-07 is a Sunday
+	candidates := []time.Time{time.Date(2024, 1, 7, 0, 0, 0, 0, time.UTC)}
+	var windows [][]*weekWindow
+	for _, amt := range weeks {
+		ws := make([]*weekWindow, 0, len(amt.Week))
+		for _, window := range amt.Week {
+			w, _ := parseWeekWindow(window)
+			ws = append(ws, w)
+			for day := time.Sunday; day <= time.Saturday; day++ {
+				if w.hasDay(day) {
+					start := time.Date(2024, 1, 7+int(day), 0, 0, 0, 0, w.loc)
+					candidates = append(candidates, start.Add(time.Duration(w.from)*time.Minute),
+						start.Add(time.Duration(w.to)*time.Minute))
+				}
+			}
+		}
+		windows = append(windows, ws)
+	}
+
+	for _, t := range candidates {
+		ok := true
+		for i, amt := range weeks {
+			in := false
+			for _, w := range windows[i] {
+				in = in || w.contains(t)
+			}
+			ok = ok && in == amt.Belong
+		}
+		if ok {
+			return t, true
+		}
+	}
+	return time.Time{}, false
+}
@@ -0,0 +1,164 @@
+package godnf_test
+
+import (
+	"testing"
+
+	dnf "github.com/brg-liuwei/godnf"
+)
+
+func TestOverlaps(t *testing.T) {
+	setDelim()
+	for _, c := range []struct {
+		a, b     string
+		expected bool
+	}{
+		{"(region in {SH, BJ})", "(region in {BJ, GZ})", true},
+		{"(region in {SH})", "(region in {BJ})", false},
+		{"(region in {SH} and age in [18, 35))", "(region not in {BJ} and age >= 30)", true},
+		{"(age in [18, 30))", "(age in [30, 40))", false},
+		{"(age in (18, 30])", "(age in [30, 40))", true},
+		{"(has gps)", "(missing gps)", false},
+		{"(region not in {SH})", "(region in {SH}) or (missing region)", true},
+		{"(region under {CN/SH})", "(region in {CN/SH/Pudong})", true},
+		{"(region under {CN/SH})", "(region under {CN/BJ})", false},
+		{"(ip in cidr {10.0.0.0/8})", "(ip not in cidr {10.0.0.0/16})", true},
+		{"(ip in cidr {10.0.0.0/8})", "(ip in cidr {192.168.0.0/16})", false},
+		{"(geo within {31.23, 121.47, 5km})", "(geo within {31.24, 121.48, 5km})", true},
+		{"(geo within {31.23, 121.47, 5km})", "(geo within {39.9, 116.4, 5km})", false},
+		{"(geo within {0, 0, 100km})", "(geo within {0, 1.5, 100km})", true},
+		{"(geo within {0, 179.5, 100km})", "(geo within {0, -179.5, 100km})", true},
+		{"(geo within {0, 0, 100km})", "(geo not within {0, 0.5, 100km})", true},
+		{"(geo within {0, 0, 10km})", "(geo not within {0, 0.05, 100km})", false},
+		{"(time in week {Mon-Fri 09:00-18:00})", "(time in week {Fri 17:00-20:00})", true},
+		{"(time in week {Mon-Fri})", "(time in week {Sat-Sun})", false},
+		{"(bucket(uid, 100, exp) in [0, 10))", "(bucket(uid, 100, exp) in [50, 60))", false},
+		{"(bucket(uid, 100, exp) in [0, 10))", "(bucket(uid, 100, other) in [0, 10) and uid not in {0, 1})", true},
+		{"(ver in [1.2.0, 2.0.0))", "(ver >= 1.10)", true},
+		{"(ver in [1.2.0, 1.10))", "(ver >= 1.10)", false},
+	} {
+		got, witness, err := dnf.Overlaps(c.a, c.b)
+		if err != nil {
+			t.Errorf("unexpected error when Overlaps %q and %q: %v", c.a, c.b, err)
+			continue
+		}
+		if got != c.expected {
+			t.Errorf("overlap of %q and %q: got %v with witness %v, expect %v", c.a, c.b, got, witness, c.expected)
+			continue
+		}
+		if !got {
+			continue
+		}
+		h := dnf.NewHandler()
+		h.SetKeyType("ver", dnf.VersionKey)
+		h.AddDoc("a", "a", c.a, attr{0, "doc"})
+		h.AddDoc("b", "b", c.b, attr{1, "doc"})
+		if docs, _ := h.SearchAll(witness); !sameDocs(h, docs, []int{0, 1}) &&
+			len(witness) != 0 {
+			t.Errorf("witness %v of %q and %q matches %v", witness, c.a, c.b, docs)
+		}
+	}
+
+	if _, _, err := dnf.Overlaps("(region in {SH}", "(region in {SH})"); err == nil {
+		t.Error("expect error when Overlaps invalid dnf")
+	}
+}
+
+func TestOverlapsMultiValued(t *testing.T) {
+	setDelim()
+	schema := &dnf.Schema{Keys: []dnf.KeySchema{{Key: "region", Multi: true}, {Key: "age", Multi: true},
+		{Key: "ip", Multi: true}, {Key: "uid", Multi: true}, {Key: "ver", Multi: true}}}
+	for _, c := range []struct {
+		a, b     string
+		expected bool
+	}{
+		{"(region in {SH})", "(region in {BJ})", true},
+		{"(region in {SH})", "(region not in {SH, BJ})", false},
+		{"(age in [18, 30))", "(age in [30, 40))", true},
+		{"(age in [18, 30))", "(age not in [0, 40))", false},
+		{"(region under {CN/SH})", "(region under {CN/BJ})", true},
+		{"(region under {CN/SH})", "(region not under {CN})", false},
+		{"(ip in cidr {10.0.0.0/8})", "(ip in cidr {192.168.0.0/16})", true},
+		{"(ip in cidr {10.1.0.0/16})", "(ip not in cidr {10.0.0.0/8})", false},
+		{"(bucket(uid, 100, exp) in [0, 10))", "(bucket(uid, 100, exp) in [50, 60))", true},
+		{"(bucket(uid, 100, exp) in [0, 10))", "(bucket(uid, 100, exp) not in [0, 50))", false},
+		{"(ver in [1.2.0, 1.10))", "(ver >= 1.10)", true},
+		{"(ver in [1.2.0, 1.10))", "(ver not in [1.0.0, 1.10.0])", false},
+		{"(ver in [1.2.0, 2.0.0))", "(ver not in [1.0.0, 1.10.0])", true},
+	} {
+		got, witness, err := dnf.OverlapsWithOptions(c.a, c.b, dnf.OverlapOptions{Schema: schema})
+		if err != nil {
+			t.Errorf("unexpected error when OverlapsWithOptions %q and %q: %v", c.a, c.b, err)
+			continue
+		}
+		if got != c.expected {
+			t.Errorf("overlap of %q and %q: got %v with witness %v, expect %v", c.a, c.b, got, witness, c.expected)
+			continue
+		}
+		if !got {
+			continue
+		}
+		h := dnf.NewHandler()
+		h.SetKeyType("ver", dnf.VersionKey)
+		h.AddDoc("a", "a", c.a, attr{0, "doc"})
+		h.AddDoc("b", "b", c.b, attr{1, "doc"})
+		if docs, _ := h.SearchAll(witness); !sameDocs(h, docs, []int{0, 1}) {
+			t.Errorf("witness %v of %q and %q matches %v", witness, c.a, c.b, docs)
+		}
+	}
+
+	// conds of SH and BJ match only b
+	a, b := "(region not in {SH})", "(region in {BJ}) or (missing region) or (region not in {SH, BJ})"
+	if ok, witness, err := dnf.EquivalentWithOptions(a, b, dnf.OverlapOptions{Schema: schema}); err != nil || ok {
+		t.Errorf("expect %q and %q not equivalent, got %v with witness %v: %v", a, b, ok, witness, err)
+	}
+	if ok, witness, err := dnf.Equivalent(a, b); err != nil || !ok {
+		t.Errorf("expect equivalence of %q and %q of a key of one value, got witness %v: %v", a, b, witness, err)
+	}
+}
+
+func TestEquivalent(t *testing.T) {
+	setDelim()
+	for _, c := range []struct {
+		a, b     string
+		expected bool
+	}{
+		{"(region in {SH, BJ})", "(region in {BJ, SH})", true},
+		{"(region in {SH}) or (region in {BJ})", "(region in {BJ, SH})", true},
+		{"(region in {SH} and age in [18, 35)) or (region in {SH})", "(region in {SH})", true},
+		{"(age in [18, 30)) or (age in [30, 40))", "(age in [18, 40))", true},
+		{"(age in [18, 30)) or (age in (30, 40))", "(age in [18, 40))", false},
+		{"(region in {SH})", "(region in {SH} and os in {ios})", false},
+		{"(region not in {SH})", "(region in {SH})", false},
+		{"(has gps)", "(gps not in {x})", false},
+		{"(region under {CN})", "(region in {CN})", false},
+		{"(region in {CN}) or (region under {CN/SH})", "(region under {CN})", false},
+		{"(region not under {CN/SH})", "(region not in {CN/SH})", false},
+		{"(region under {CN/SH, CN})", "(region under {CN})", true},
+		{"(geo within {0, 0, 100km})", "(geo within {0, 1.5, 100km})", false},
+		{"(geo within {0, 0, 100km})", "(geo within {0, 0.5, 100km})", false},
+		{"(geo within {0, 0, 100km}) or (geo within {0, 0, 50km})", "(geo within {0, 0, 100km})", true},
+	} {
+		got, witness, err := dnf.Equivalent(c.a, c.b)
+		if err != nil {
+			t.Errorf("unexpected error when Equivalent %q and %q: %v", c.a, c.b, err)
+			continue
+		}
+		if got != c.expected {
+			t.Errorf("equivalence of %q and %q: got %v with witness %v, expect %v", c.a, c.b, got, witness, c.expected)
+		}
+		if !got && !c.expected {
+			h := dnf.NewHandler()
+			h.AddDoc("a", "a", c.a, attr{0, "doc"})
+			h.AddDoc("b", "b", c.b, attr{1, "doc"})
+			if docs, _ := h.SearchAll(witness); len(docs) != 1 && len(witness) != 0 {
+				t.Errorf("witness %v of %q and %q matches %v", witness, c.a, c.b, docs)
+			}
+		}
+	}
+
+	// no location in the circle and out of both others is found, which is not reported as equivalent
+	a, b := "(geo within {0, 0, 100km})", "(geo within {0, 0.5, 100km}) or (geo within {0, -0.5, 100km})"
+	if got, _, err := dnf.Equivalent(a, b); err == nil {
+		t.Errorf("expect error when Equivalent %q and %q, got %v", a, b, got)
+	}
+}
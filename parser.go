@@ -0,0 +1,489 @@
+package godnf
+
+import (
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// Expr is the syntax tree of a dnf:
+//
+//	(age in {3, 4} and state not in {CA}) or (gender in {M})
+//
+// is parsed into an Expr with two conjunctions:
+//
+//	conj1: age in {3, 4} and state not in {CA}
+//	conj2: gender in {M}
+type Expr struct {
+	Conjs []*Conjunction
+}
+
+// Conjunction is a conjunction of assignments in an Expr
+type Conjunction struct {
+	Pos  int // byte offset of the left delim of this conjunction
+	Amts []*Assignment
+}
+
+// Assignment is a single `key [not] in {vals}`, `key [not] under {paths}`,
+// `key [not] in cidr {prefixes}`, `key [not] in [min, max)`, `key [not] within {lat, lon, radius}`,
+// `key [not] in week {windows}`, `bucket(key, mod, salt) [not] in [min, max)`,
+// `has key`, `missing key` or `key [not] in @name` of a Conjunction
+type Assignment struct {
+	Pos    int // byte offset of the key of this assignment
+	Key    string
+	Belong bool     // true: in (∈), false: not in (∉)
+	Vals   []string // values of set, nil if Range is not nil
+	Range  *Range   // numeric range, nil if the assignment is a set
+	Under  bool     // Vals are paths, matched by themselves and any descendant
+	CIDR   bool     // Vals are IPv4 or IPv6 prefixes like 10.0.0.0/8
+	Geo    *GeoArea // geo area, nil if the assignment is not a geo predicate
+	Week   []string // weekly time windows like Mon-Fri 09:00-18:00 Asia/Shanghai
+	Bucket *Bucket  // bucket of values of key, Range is the range of the bucket
+	Exists bool     // has key (Belong is true) or missing key (Belong is false)
+
+	NamedSet string // name of a set registered by Handler.RegisterSet, Vals is nil if it is not ""
+}
+
+// ParseDNF parses dnf into an Expr with the default syntax
+func ParseDNF(dnf string) (*Expr, error) {
+	return DefaultSyntax().Parse(dnf)
+}
+
+type parser struct {
+	src     string
+	pos     int
+	syntax  Syntax
+	lenient bool // allow duplicate keys in a conjunction and empty sets, see LintDNF
+}
+
+func (p *parser) parse() (*Expr, error) {
+	expr := &Expr{Conjs: make([]*Conjunction, 0, 1)}
+	for {
+		conj, err := p.parseConj()
+		if err != nil {
+			return nil, err
+		}
+		expr.Conjs = append(expr.Conjs, conj)
+
+		p.skipSpace()
+		if p.eof() {
+			return expr, nil
+		}
+		if start := p.pos; !isKeyword(p.token(), "or", "||") {
+			return nil, p.errorAt(start, "or", "||", "EOF")
+		}
+	}
+}
+
+// conj: ( age in {3, 4} and state not in {CA, NY} )
+func (p *parser) parseConj() (*Conjunction, error) {
+	p.skipSpace()
+	if p.peek() != p.syntax.LeftDelimOfConj {
+		return nil, p.errorAt(p.pos, string(p.syntax.LeftDelimOfConj))
+	}
+	conj := &Conjunction{Pos: p.pos, Amts: make([]*Assignment, 0, 1)}
+	p.next()
+
+	keys := make(map[string]bool)
+	for {
+		amt, err := p.parseAmt()
+		if err != nil {
+			return nil, err
+		}
+		if keys[amt.target()] && !p.lenient {
+			err := p.errorAt(amt.Pos)
+			err.Msg = "conjunction key " + amt.target() + " duplicate"
+			return nil, err
+		}
+		keys[amt.target()] = true
+		conj.Amts = append(conj.Amts, amt)
+
+		p.skipSpace()
+		if p.peek() == p.syntax.RightDelimOfConj {
+			p.next()
+			return conj, nil
+		}
+		if start := p.pos; !isKeyword(p.token(), "and", "&&") {
+			return nil, p.errorAt(start, "and", "&&", string(p.syntax.RightDelimOfConj))
+		}
+	}
+}
+
+// amt: age not in {3, 4}, age = 3, age != 3, age in [18, 35), age > 60 or has age
+func (p *parser) parseAmt() (*Assignment, error) {
+	p.skipSpace()
+	amt := &Assignment{Pos: p.pos, Belong: true}
+	key, err := p.literal(p.word, "key")
+	if err != nil {
+		return nil, err
+	}
+	amt.Key = key
+	if isKeyword(key, "has", "missing") && p.src[amt.Pos] != '"' {
+		// `has in {...}` means a key named has
+		p.skipSpace()
+		start := p.pos
+		if r := p.peek(); r == '"' || (!p.eof() && !p.syntax.isDelim(r) && !isOpChar(r)) {
+			if tok := p.word(); r == '"' || !isKeyword(tok, "in", "not", "under", "within") {
+				p.pos = start
+				if amt.Key, err = p.literal(p.word, "key"); err != nil {
+					return nil, err
+				}
+				amt.Exists, amt.Belong = true, isKeyword(key, "has")
+				return amt, nil
+			}
+		}
+		p.pos = start
+	}
+	if isKeyword(key, "bucket") && p.src[amt.Pos] != '"' && p.peek() == p.syntax.LeftDelimOfConj {
+		p.next()
+		if amt.Key, amt.Bucket, err = p.parseBucket(); err != nil {
+			return nil, err
+		}
+		if amt.Range, amt.Belong, err = p.parseBucketRange(); err != nil {
+			return nil, err
+		}
+		return amt, nil
+	}
+
+	p.skipSpace()
+	start := p.pos
+	switch op := p.token(); {
+	case op == "=" || op == "!=":
+		// shorthand of single-element in and not in
+		amt.Belong = op == "="
+		p.skipSpace()
+		val, err := p.literal(p.word, "value")
+		if err != nil {
+			return nil, err
+		}
+		amt.Vals = []string{val}
+		return amt, nil
+	case isComparison(op):
+		if amt.Range, err = p.parseComparison(op); err != nil {
+			return nil, err
+		}
+		return amt, nil
+	case isKeyword(op, "not"):
+		amt.Belong = false
+		p.skipSpace()
+		start = p.pos
+		switch op := p.token(); {
+		case isKeyword(op, "under"):
+			amt.Under = true
+		case isKeyword(op, "within"):
+			if amt.Geo, err = p.parseGeo(); err != nil {
+				return nil, err
+			}
+			return amt, nil
+		case !isKeyword(op, "in"):
+			return nil, p.errorAt(start, "in", "under", "within")
+		}
+	case isKeyword(op, "under"):
+		amt.Under = true
+	case isKeyword(op, "within"):
+		if amt.Geo, err = p.parseGeo(); err != nil {
+			return nil, err
+		}
+		return amt, nil
+	case !isKeyword(op, "in"):
+		return nil, p.errorAt(start, "in", "not", "under", "within", "=", "!=", "<", "<=", ">", ">=")
+	}
+
+	// a set delim like '[' takes precedence over range
+	if p.skipSpace(); !amt.Under && !p.syntax.isSetDelim(p.peek()) && (p.peek() == '[' || p.peek() == '(') {
+		if amt.Range, err = p.parseRange(); err != nil {
+			return nil, err
+		}
+		return amt, nil
+	}
+
+	if !amt.Under && p.peek() == '@' && !p.syntax.isSetDelim('@') {
+		p.next()
+		if amt.NamedSet, err = p.literal(p.word, "set name"); err != nil {
+			return nil, err
+		}
+		return amt, nil
+	}
+
+	if !amt.Under && !p.syntax.isSetDelim(p.peek()) {
+		start = p.pos
+		switch word := p.word(); {
+		case isKeyword(word, "week"):
+			if amt.Week, err = p.parseWeek(); err != nil {
+				return nil, err
+			}
+			return amt, nil
+		case !isKeyword(word, "cidr"):
+			return nil, p.errorAt(start, string(p.syntax.LeftDelimOfSet), "@", "cidr", "week")
+		}
+		amt.CIDR = true
+		p.skipSpace()
+		start = p.pos
+	}
+
+	vals, err := p.parseSet()
+	if err != nil {
+		return nil, err
+	}
+	if amt.CIDR {
+		for _, val := range vals {
+			if _, _, err := net.ParseCIDR(val); err != nil {
+				perr := p.errorAt(start)
+				perr.Msg = "invalid cidr " + val
+				return nil, perr
+			}
+		}
+	}
+	amt.Vals = vals
+	return amt, nil
+}
+
+// set: {3, 4}
+func (p *parser) parseSet() ([]string, error) {
+	p.skipSpace()
+	if p.peek() != p.syntax.LeftDelimOfSet {
+		return nil, p.errorAt(p.pos, string(p.syntax.LeftDelimOfSet))
+	}
+	p.next()
+
+	vals := make([]string, 0, 1)
+	if p.skipSpace(); p.lenient && p.peek() == p.syntax.RightDelimOfSet {
+		p.next()
+		return vals, nil
+	}
+	for {
+		p.skipSpace()
+		val, err := p.literal(p.value, "value")
+		if err != nil {
+			return nil, err
+		}
+		vals = append(vals, val)
+
+		p.skipSpace()
+		switch p.peek() {
+		case p.syntax.SeparatorOfSet:
+			p.next()
+		case p.syntax.RightDelimOfSet:
+			p.next()
+			return vals, nil
+		default:
+			return nil, p.errorAt(p.pos, string(p.syntax.SeparatorOfSet), string(p.syntax.RightDelimOfSet))
+		}
+	}
+}
+
+const eofRune rune = -1
+
+func (p *parser) eof() bool {
+	return p.pos >= len(p.src)
+}
+
+func (p *parser) peek() rune {
+	if p.eof() {
+		return eofRune
+	}
+	r, _ := utf8.DecodeRuneInString(p.src[p.pos:])
+	return r
+}
+
+func (p *parser) next() {
+	if !p.eof() {
+		_, n := utf8.DecodeRuneInString(p.src[p.pos:])
+		p.pos += n
+	}
+}
+
+func (p *parser) skipSpace() {
+	for !p.eof() && unicode.IsSpace(p.peek()) {
+		p.next()
+	}
+}
+
+// scan scans runes until stop returns true and returns the scanned string
+func (p *parser) scan(stop func(r rune) bool) string {
+	start := p.pos
+	for !p.eof() && !stop(p.peek()) {
+		p.next()
+	}
+	return p.src[start:p.pos]
+}
+
+// literal scans a double-quoted string or an unquoted token by scan,
+// expected is reported when there is no token at all
+func (p *parser) literal(scan func() string, expected string) (string, error) {
+	if p.peek() == '"' {
+		return p.quoted()
+	}
+	start := p.pos
+	if tok := scan(); tok != "" {
+		return tok, nil
+	}
+	return "", p.errorAt(start, expected)
+}
+
+// quoted scans a double-quoted string with backslash escapes: "New York", "a\"b"
+func (p *parser) quoted() (string, error) {
+	start := p.pos
+	p.next()
+	for !p.eof() {
+		switch p.peek() {
+		case '\\':
+			p.next()
+		case '"':
+			p.next()
+			s, err := strconv.Unquote(p.src[start:p.pos])
+			if err != nil {
+				perr := p.errorAt(start)
+				perr.Msg = "invalid quoted string " + p.src[start:p.pos]
+				return "", perr
+			}
+			return s, nil
+		}
+		p.next()
+	}
+	perr := p.errorAt(start)
+	perr.Msg = "unterminated quoted string"
+	return "", perr
+}
+
+// word scans a key or a keyword outside of sets
+func (p *parser) word() string {
+	return p.scan(func(r rune) bool {
+		return unicode.IsSpace(r) || p.syntax.isDelim(r) || isOpChar(r)
+	})
+}
+
+// token scans an operator like = or &&, or a word
+func (p *parser) token() string {
+	if r := p.peek(); !isOpChar(r) || p.syntax.isDelim(r) {
+		return p.word()
+	}
+	return p.scan(func(r rune) bool {
+		return !isOpChar(r) || p.syntax.isDelim(r)
+	})
+}
+
+const opChars = "=!<>&|"
+
+func isOpChar(r rune) bool {
+	return strings.ContainsRune(opChars, r)
+}
+
+// isKeyword reports whether tok is one of keywords, ignoring case
+func isKeyword(tok string, keywords ...string) bool {
+	for _, keyword := range keywords {
+		if strings.EqualFold(tok, keyword) {
+			return true
+		}
+	}
+	return false
+}
+
+// value scans an elem of set
+func (p *parser) value() string {
+	return p.scan(func(r rune) bool {
+		return unicode.IsSpace(r) || p.syntax.isSetDelim(r)
+	})
+}
+
+func (s Syntax) isSetDelim(r rune) bool {
+	return r == s.SeparatorOfSet || r == s.LeftDelimOfSet || r == s.RightDelimOfSet
+}
+
+func (s Syntax) isDelim(r rune) bool {
+	return s.isSetDelim(r) || r == s.LeftDelimOfConj || r == s.RightDelimOfConj
+}
+
+// quote double-quotes v if it can not be parsed back as an unquoted token
+func (s Syntax) quote(v string) string {
+	if v == "" || v[0] == '"' {
+		return strconv.Quote(v)
+	}
+	for _, r := range v {
+		if unicode.IsSpace(r) || s.isDelim(r) || isOpChar(r) || !unicode.IsPrint(r) {
+			return strconv.Quote(v)
+		}
+	}
+	return v
+}
+
+// errorAt creates a ParseError at offset with the expected tokens
+func (p *parser) errorAt(offset int, expected ...string) *ParseError {
+	return newParseError(p.src, offset, p.tokenAt(offset), expected)
+}
+
+// tokenAt returns the token starting at offset for error reporting
+func (p *parser) tokenAt(offset int) string {
+	q := &parser{src: p.src, pos: offset, syntax: p.syntax}
+	if q.eof() {
+		return "EOF"
+	}
+	if tok := q.token(); tok != "" {
+		return tok
+	}
+	return string(q.peek())
+}
+
+// ParseError describes where and why a dnf failed to parse.
+// All syntax errors returned by ParseDNF, DnfCheck and AddDoc are *ParseError
+type ParseError struct {
+	Dnf      string   // the dnf being parsed
+	Offset   int      // byte offset of the error in Dnf
+	Line     int      // line of the error, starts from 1
+	Column   int      // column (in runes) of the error, starts from 1
+	Found    string   // token found at Offset, "EOF" at the end of Dnf
+	Expected []string // tokens expected at Offset
+	Msg      string   // description of the error, if it is not a token mismatch
+	Snippet  string   // the line of the error with a caret under Column
+}
+
+func newParseError(dnf string, offset int, found string, expected []string) *ParseError {
+	lineStart := strings.LastIndex(dnf[:offset], "\n") + 1
+	lineEnd := strings.IndexByte(dnf[offset:], '\n')
+	if lineEnd < 0 {
+		lineEnd = len(dnf)
+	} else {
+		lineEnd += offset
+	}
+	line := strings.TrimRight(dnf[lineStart:lineEnd], "\r")
+
+	// keep tabs so that the caret lines up with the snippet
+	caret := make([]rune, 0, offset-lineStart+1)
+	for _, r := range dnf[lineStart:offset] {
+		if r == '\t' {
+			caret = append(caret, '\t')
+		} else {
+			caret = append(caret, ' ')
+		}
+	}
+	caret = append(caret, '^')
+
+	return &ParseError{
+		Dnf:      dnf,
+		Offset:   offset,
+		Line:     strings.Count(dnf[:offset], "\n") + 1,
+		Column:   utf8.RuneCountInString(dnf[lineStart:offset]) + 1,
+		Found:    found,
+		Expected: expected,
+		Snippet:  line + "\n" + string(caret),
+	}
+}
+
+func (e *ParseError) Error() string {
+	return fmt.Sprintf("dnf format error at line %d, column %d: %s", e.Line, e.Column, e.Message())
+}
+
+// Message returns Msg, or the description of token mismatch, without the position
+func (e *ParseError) Message() string {
+	if e.Msg != "" {
+		return e.Msg
+	}
+	quoted := make([]string, 0, len(e.Expected))
+	for _, tok := range e.Expected {
+		quoted = append(quoted, strconv.Quote(tok))
+	}
+	return "found " + strconv.Quote(e.Found) + ", expected " + strings.Join(quoted, " or ")
+}
@@ -0,0 +1,171 @@
+package godnf_test
+
+import (
+	"encoding/json"
+	"errors"
+	"reflect"
+	"testing"
+
+	dnf "github.com/brg-liuwei/godnf"
+)
+
+func TestParseDNF(t *testing.T) {
+	setDelim()
+	expr, err := dnf.ParseDNF("(region in {SH, BJ} and age not in {3}) or ( gender in { male } )")
+	if err != nil {
+		t.Fatal("unexpected error when ParseDNF: ", err)
+	}
+	if len(expr.Conjs) != 2 {
+		t.Fatalf("expect 2 conjunctions, got %d", len(expr.Conjs))
+	}
+	if s := expr.ToString(); s != "( region ∈ { SH, BJ } ∩ age ∉ { 3 } ) ∪ ( gender ∈ { male } )" {
+		t.Error("unexpected expr: ", s)
+	}
+
+	amt := expr.Conjs[0].Amts[1]
+	if amt.Key != "age" || amt.Belong || len(amt.Vals) != 1 || amt.Vals[0] != "3" {
+		t.Errorf("unexpected assignment: %+v", amt)
+	}
+	if amt.Pos != 24 {
+		t.Error("unexpected assignment pos: ", amt.Pos)
+	}
+	if pos := expr.Conjs[1].Pos; pos != 43 {
+		t.Error("unexpected conjunction pos: ", pos)
+	}
+}
+
+func TestParseDNFError(t *testing.T) {
+	setDelim()
+	for _, s := range []string{
+		"(region in {})",
+		"(region in {SH,})",
+		"(region in {SH}) and (age in {3})",
+		"(region in {SH}) or",
+		"(region {SH})",
+		"(in {SH})",
+	} {
+		if _, err := dnf.ParseDNF(s); err == nil {
+			t.Error("expect error when ParseDNF: ", s)
+		}
+	}
+}
+
+func TestParseError(t *testing.T) {
+	setDelim()
+	checkErr := func(s string, line, column int, found string, expected ...string) *dnf.ParseError {
+		var perr *dnf.ParseError
+		if err := dnf.DnfCheck(s); !errors.As(err, &perr) {
+			t.Fatalf("expect *ParseError when DnfCheck %q, got %v", s, err)
+		}
+		if perr.Line != line || perr.Column != column || perr.Found != found {
+			t.Errorf("unexpected error position of %q: %d:%d %q", s, perr.Line, perr.Column, perr.Found)
+		}
+		if expected != nil && !reflect.DeepEqual(perr.Expected, expected) {
+			t.Errorf("unexpected expected tokens of %q: %v", s, perr.Expected)
+		}
+		return perr
+	}
+
+	perr := checkErr("(city not on {BJ})", 1, 11, "on", "in", "under", "within")
+	if perr.Offset != 10 {
+		t.Error("unexpected offset: ", perr.Offset)
+	}
+	if perr.Snippet != "(city not on {BJ})\n          ^" {
+		t.Errorf("unexpected snippet:\n%s", perr.Snippet)
+	}
+	if perr.Error() != `dnf format error at line 1, column 11: found "on", expected "in" or "under" or "within"` {
+		t.Error("unexpected error message: ", perr.Error())
+	}
+
+	checkErr("(city in {BJ})\nor (age in {3} or", 2, 16, "or", "and", "&&", ")")
+	checkErr("(city in {BJ}) or", 1, 18, "EOF", "(")
+	checkErr("(城市 in {北京 上海})", 1, 12, "上海", ",", "}")
+
+	perr = checkErr("(city in {BJ} and age in {3} and city not in {SH})", 1, 34, "city")
+	if perr.Msg != "conjunction key city duplicate" {
+		t.Error("unexpected duplicate key message: ", perr.Msg)
+	}
+}
+
+func TestParseQuoted(t *testing.T) {
+	setDelim()
+	expr, err := dnf.ParseDNF(`("home city" in {"New York", "São Paulo", "a,b", "{x}", "say \"hi\"", "", "上海", BJ})`)
+	if err != nil {
+		t.Fatal("unexpected error when ParseDNF: ", err)
+	}
+	amt := expr.Conjs[0].Amts[0]
+	expected := []string{"New York", "São Paulo", "a,b", "{x}", `say "hi"`, "", "上海", "BJ"}
+	if amt.Key != "home city" || !reflect.DeepEqual(amt.Vals, expected) {
+		t.Errorf("unexpected assignment: %q %q", amt.Key, amt.Vals)
+	}
+	if s := expr.ToString(); s != `( "home city" ∈ { "New York", "São Paulo", "a,b", "{x}", "say \"hi\"", "", 上海, BJ } )` {
+		t.Error("unexpected expr: ", s)
+	}
+
+	for _, s := range []string{
+		`(city in {"New York})`,
+		`(city in {"New\q"})`,
+		`(city in {"New" York})`,
+	} {
+		var perr *dnf.ParseError
+		if err := dnf.DnfCheck(s); !errors.As(err, &perr) {
+			t.Errorf("expect *ParseError when DnfCheck %q, got %v", s, err)
+		}
+	}
+}
+
+func TestQuotedRetrieval(t *testing.T) {
+	h := dnf.NewHandlerWithoutLock()
+	if err := h.AddDoc("doc-0", "0", `(city in {"New York", "São Paulo"})`, attr{0, "doc-0"}); err != nil {
+		t.Fatal("unexpected error when AddDoc: ", err)
+	}
+	for _, city := range []string{"New York", "São Paulo"} {
+		docs, err := h.SearchAll([]dnf.Cond{{Key: "city", Val: city}})
+		if err != nil || len(docs) != 1 {
+			t.Errorf("search %s: docs %v, err %v", city, docs, err)
+		}
+	}
+}
+
+func TestParseAliases(t *testing.T) {
+	setDelim()
+	for _, s := range []string{
+		"(region IN {SH, BJ} AND age NOT IN {3}) OR (gender In {male})",
+		"(region in {SH, BJ} && age != 3) || (gender = male)",
+		"(region in{SH,BJ}&&age!=3)||(gender=male)",
+		`(region in {SH, BJ} and age Not in {"3"}) or (gender = "male")`,
+	} {
+		expr, err := dnf.ParseDNF(s)
+		if err != nil {
+			t.Errorf("unexpected error when ParseDNF %q: %v", s, err)
+			continue
+		}
+		if c := dnf.DefaultSyntax().Print(expr); c != "(region in {SH, BJ} and age not in {3}) or (gender in {male})" {
+			t.Errorf("unexpected canonical form of %q: %s", s, c)
+		}
+	}
+
+	for _, s := range []string{
+		"(region == SH)",
+		"(region = {SH})",
+		"(region in {SH} & age in {3})",
+		"(region in {SH}) | (age in {3})",
+		"(region not = SH)",
+	} {
+		if _, err := dnf.ParseDNF(s); err == nil {
+			t.Error("expect error when ParseDNF: ", s)
+		}
+	}
+}
+
+func TestCanonicalDnfOfDoc(t *testing.T) {
+	h := dnf.NewHandlerWithoutLock()
+	if err := h.AddDoc("doc-0", "0", `(city = "New York" AND age != 3) || (gender IN { male })`, attr{0, "doc-0"}); err != nil {
+		t.Fatal("unexpected error when AddDoc: ", err)
+	}
+	var m map[string]map[string]interface{}
+	json.Unmarshal(h.DumpByDocId(), &m)
+	if s := m["0"]["dnf"]; s != `(city in {"New York"} and age not in {3}) or (gender in {male})` {
+		t.Error("unexpected dnf of doc: ", s)
+	}
+}
@@ -0,0 +1,72 @@
+package godnf
+
+import (
+	"errors"
+	"strings"
+)
+
+// DefaultPathSeparator is the default separator of hierarchical values like CN/SH/Pudong
+const DefaultPathSeparator = "/"
+
+// SetPathSeparator set the separator of paths matched by `under`,
+// it must be called before adding docs, or an error is returned
+func (h *Handler) SetPathSeparator(sep string) error {
+	if h.GetDocSize() != 0 {
+		return errors.New("path separator can not be set after docs are added")
+	}
+	h.confLock.Lock()
+	h.pathSep = sep
+	h.confLock.Unlock()
+	return nil
+}
+
+// pathSeparator returns the separator of paths
+func (h *Handler) pathSeparator() string {
+	h.confLock.RLock()
+	defer h.confLock.RUnlock()
+	return h.pathSep
+}
+
+// cleanPath removes trailing separators of path: CN/SH/ --> CN/SH
+func (h *Handler) cleanPath(path string) string {
+	sep := h.pathSeparator()
+	for sep != "" && len(path) > len(sep) && strings.HasSuffix(path, sep) {
+		path = path[:len(path)-len(sep)]
+	}
+	return path
+}
+
+// underIndexAdd marks key as having path terms, so that searching the key looks up ancestors
+func (h *Handler) underIndexAdd(key string) {
+	h.termMapLock.RLock()
+	ok := h.underKeys[key]
+	h.termMapLock.RUnlock()
+	if ok {
+		return
+	}
+	h.termMapLock.Lock()
+	h.underKeys[key] = true
+	h.termMapLock.Unlock()
+}
+
+// underLookup appends ids of path terms which are cond.Val or its ancestors to termids:
+// CN/SH/Pudong looks up CN, CN/SH and CN/SH/Pudong, it must be called with termMapLock held
+func (h *Handler) underLookup(cond *Cond, termids []int) []int {
+	sep := h.pathSeparator()
+	path := h.cleanPath(cond.Val)
+	term := &Term{key: cond.Key, kind: underTerm}
+	for i := 0; i < len(path); {
+		end := len(path)
+		if sep != "" {
+			if n := strings.Index(path[i+1:], sep); n >= 0 {
+				end = i + 1 + n
+			}
+		}
+		term.val = path[:end]
+		if id, ok := h.termMap[term.mapKey()]; ok {
+			termids = append(termids, id)
+		}
+		i = end + len(sep)
+	}
+	return termids
+}
@@ -0,0 +1,144 @@
+package godnf_test
+
+import (
+	"testing"
+
+	dnf "github.com/brg-liuwei/godnf"
+)
+
+func TestParseUnder(t *testing.T) {
+	setDelim()
+	for _, c := range []struct {
+		dnf      string
+		expected string
+	}{
+		{"(region under {US, CN/SH} and age in {3})", "(age in {3} and region under {CN/SH, US})"},
+		{"(category NOT UNDER {IAB1/IAB1-2})", "(category not under {IAB1/IAB1-2})"},
+	} {
+		if got, err := dnf.FormatDNF(c.dnf); err != nil {
+			t.Errorf("unexpected error when FormatDNF %q: %v", c.dnf, err)
+		} else if got != c.expected {
+			t.Errorf("unexpected dnf of %q: %s", c.dnf, got)
+		}
+	}
+
+	b, err := dnf.DNFToJSON("(region under {CN/SH} and category not under {IAB1})")
+	if err != nil {
+		t.Fatal("unexpected error when DNFToJSON: ", err)
+	}
+	if string(b) != `{"or":[{"and":[{"key":"region","under":["CN/SH"]},{"key":"category","not_under":["IAB1"]}]}]}` {
+		t.Error("unexpected json: ", string(b))
+	}
+	if s, err := dnf.JSONToDNF(b); err != nil || s != "(region under {CN/SH} and category not under {IAB1})" {
+		t.Error("unexpected dnf from json: ", s, err)
+	}
+
+	if err := dnf.DnfCheck("(region under [CN/SH])"); err == nil {
+		t.Error("expect error when DnfCheck a range of under")
+	}
+}
+
+func TestUnderRetrieval(t *testing.T) {
+	h := dnf.NewHandlerWithoutLock()
+	for i, s := range []string{
+		"(region under {CN/SH})",                            // docid: 0
+		"(region under {CN/})",                              // docid: 1
+		"(region not under {CN/SH} and category in {IAB1})", // docid: 2
+		"(region under {CN/SH/Pudong, US})",                 // docid: 3
+	} {
+		if err := h.AddDoc("doc", string(rune('0'+i)), s, attr{i, "doc"}); err != nil {
+			t.Fatal("unexpected error when AddDoc: ", err)
+		}
+	}
+
+	for _, c := range []struct {
+		conds    []dnf.Cond
+		expected []int
+	}{
+		{[]dnf.Cond{{"region", "CN/SH/Pudong"}}, []int{0, 1, 3}},
+		{[]dnf.Cond{{"region", "CN/SH"}}, []int{0, 1}},
+		{[]dnf.Cond{{"region", "CN/SHX"}}, []int{1}},
+		{[]dnf.Cond{{"region", "CN"}}, []int{1}},
+		{[]dnf.Cond{{"region", "US/NY"}, {"category", "IAB1"}}, []int{2, 3}},
+		{[]dnf.Cond{{"region", "CN/SH/Minhang"}, {"category", "IAB1"}}, []int{0, 1}},
+	} {
+		docs, err := h.SearchAll(c.conds)
+		if err != nil {
+			t.Fatal("unexpected error when Search: ", err)
+		}
+		if !sameDocs(h, docs, c.expected) {
+			t.Errorf("unexpected docs of %v: %v, expect %v", c.conds, docs, c.expected)
+		}
+	}
+}
+
+func TestPathSeparator(t *testing.T) {
+	h := dnf.NewHandlerWithoutLock()
+	if err := h.SetPathSeparator("::"); err != nil {
+		t.Fatal("unexpected error when SetPathSeparator: ", err)
+	}
+	if err := h.AddDoc("doc", "0", "(category under {IAB1::IAB1-2})", attr{0, "doc"}); err != nil {
+		t.Fatal("unexpected error when AddDoc: ", err)
+	}
+	if err := h.SetPathSeparator("/"); err == nil {
+		t.Error("expect error when SetPathSeparator after docs are added")
+	}
+	for val, n := range map[string]int{
+		"IAB1::IAB1-2::x": 1,
+		"IAB1::IAB1-2":    1,
+		"IAB1::IAB1-20":   0,
+		"IAB1/IAB1-2/x":   0,
+	} {
+		if docs, _ := h.SearchAll([]dnf.Cond{{"category", val}}); len(docs) != n {
+			t.Errorf("expect %d docs of %s, got %d", n, val, len(docs))
+		}
+	}
+}
+
+func TestUnderCountedOnce(t *testing.T) {
+	h := dnf.NewHandlerWithoutLock()
+	// a path found by several paths of an assignment counts once
+	if err := h.AddDoc("doc", "0", "(region under {CN, CN/SH} and os in {ios})", attr{0, "doc"}); err != nil {
+		t.Fatal("unexpected error when AddDoc: ", err)
+	}
+	// assignments of a conjunction sharing a term count separately
+	if err := h.AddBoolExpr("doc", "1", "region under {CN} and region under {CN, US}", attr{1, "doc"}); err != nil {
+		t.Fatal("unexpected error when AddBoolExpr: ", err)
+	}
+
+	for _, c := range []struct {
+		conds    []dnf.Cond
+		expected []int
+	}{
+		{[]dnf.Cond{{"region", "CN/SH/Pudong"}}, []int{1}},
+		{[]dnf.Cond{{"region", "CN/SH/Pudong"}, {"os", "ios"}}, []int{0, 1}},
+		{[]dnf.Cond{{"region", "CN"}}, []int{1}},
+		{[]dnf.Cond{{"region", "US"}}, []int{}},
+	} {
+		docs, err := h.SearchAll(c.conds)
+		if err != nil {
+			t.Fatal("unexpected error when Search: ", err)
+		}
+		if !sameDocs(h, docs, c.expected) {
+			t.Errorf("unexpected docs of %v: %v, expect %v", c.conds, docs, c.expected)
+		}
+	}
+}
+
+// sameDocs reports whether attrs of docs are the docIds of expected
+func sameDocs(h *dnf.Handler, docs []int, expected []int) bool {
+	if len(docs) != len(expected) {
+		return false
+	}
+	m := make(map[int]bool, len(expected))
+	for _, id := range expected {
+		m[id] = true
+	}
+	for _, doc := range docs {
+		a, err := h.DocId2Attr(doc)
+		if err != nil || !m[a.(attr).docId] {
+			return false
+		}
+	}
+	return true
+}
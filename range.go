@@ -0,0 +1,370 @@
+package godnf
+
+import (
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+// Range is a numeric interval of an Assignment like age in [18, 35),
+// comparisons are ranges with an unbounded side: age > 60 is age in (60, +inf)
+type Range struct {
+	Min     string // lower bound, "" means -inf
+	Max     string // upper bound, "" means +inf
+	MinIncl bool   // is Min included
+	MaxIncl bool   // is Max included
+}
+
+// bounds returns the bounds of r as values of type t, nil means unbounded
+func (r *Range) bounds(t KeyType) (lo, hi bound, err error) {
+	if r.Min != "" {
+		if lo, err = parseBound(t, r.Min); err != nil {
+			return
+		}
+	}
+	if r.Max != "" {
+		if hi, err = parseBound(t, r.Max); err != nil {
+			return
+		}
+	}
+	return
+}
+
+// keyType returns the type of r by its bounds: a range is numeric
+// if all bounds are numbers like [2.5, 10), else a version range like [5.2.1, 6)
+func (r *Range) keyType() KeyType {
+	if _, _, err := r.bounds(NumberKey); err != nil {
+		return VersionKey
+	}
+	return NumberKey
+}
+
+// check returns false and the reason if r is not a valid range of type t or r is empty
+func (r *Range) check(t KeyType) (msg string, ok bool) {
+	lo, hi, err := r.bounds(t)
+	if err != nil {
+		return err.Error(), false
+	}
+	if lo != nil && hi != nil {
+		if c := lo.compare(hi); c > 0 || (c == 0 && !(r.MinIncl && r.MaxIncl)) {
+			return "empty range " + r.String(), false
+		}
+	}
+	return "", true
+}
+
+func (r *Range) contains(t KeyType, x bound) bool {
+	lo, hi, _ := r.bounds(t)
+	iv := newNumInterval(r, lo, hi, 0)
+	return iv.contains(x)
+}
+
+// intersect returns r ∩ o as ranges of type t, or nil if it is empty
+func (r *Range) intersect(t KeyType, o *Range) *Range {
+	rlo, rhi, _ := r.bounds(t)
+	olo, ohi, _ := o.bounds(t)
+	rc := *r
+	if olo != nil && (rlo == nil || olo.compare(rlo) > 0 || (olo.compare(rlo) == 0 && !o.MinIncl)) {
+		rc.Min, rc.MinIncl = o.Min, o.MinIncl
+	}
+	if ohi != nil && (rhi == nil || ohi.compare(rhi) < 0 || (ohi.compare(rhi) == 0 && !o.MaxIncl)) {
+		rc.Max, rc.MaxIncl = o.Max, o.MaxIncl
+	}
+	if _, ok := rc.check(t); !ok {
+		return nil
+	}
+	return &rc
+}
+
+// String prints r as an interval like [18, 35) or (60, +inf)
+func (r *Range) String() string {
+	left, right := "(", ")"
+	if r.MinIncl && r.Min != "" {
+		left = "["
+	}
+	if r.MaxIncl && r.Max != "" {
+		right = "]"
+	}
+	min, max := r.Min, r.Max
+	if min == "" {
+		min = "-inf"
+	}
+	if max == "" {
+		max = "+inf"
+	}
+	return left + min + ", " + max + right
+}
+
+// canonical returns the interval of r with normalized bounds of type t,
+// 18.0 and 18 are the same number, 5.2.0 and 5.2 are the same version
+func (r *Range) canonical(t KeyType) string {
+	lo, hi, _ := r.bounds(t)
+	c := &Range{MinIncl: r.MinIncl, MaxIncl: r.MaxIncl}
+	if lo != nil {
+		c.Min = lo.String()
+	}
+	if hi != nil {
+		c.Max = hi.String()
+	}
+	return c.String()
+}
+
+// bound is a value compared by ranges, a number or a version
+type bound interface {
+	compare(o bound) int
+	String() string
+}
+
+type number float64
+
+func (x number) compare(o bound) int {
+	switch y := o.(number); {
+	case x < y:
+		return -1
+	case x > y:
+		return 1
+	}
+	return 0
+}
+
+func (x number) String() string {
+	return strconv.FormatFloat(float64(x), 'g', -1, 64)
+}
+
+// parseBound parses s as a value of type t
+func parseBound(t KeyType, s string) (bound, error) {
+	if t == VersionKey {
+		return parseVersion(s)
+	}
+	x, err := parseNumber(s)
+	return number(x), err
+}
+
+// parseNumber parses a finite number of range
+func parseNumber(s string) (float64, error) {
+	f, err := strconv.ParseFloat(s, 64)
+	if err != nil || math.IsNaN(f) || math.IsInf(f, 0) {
+		return 0, &strconv.NumError{Func: "parseNumber", Num: s, Err: strconv.ErrSyntax}
+	}
+	return f, nil
+}
+
+func isInfBound(s string) bool {
+	s = strings.TrimPrefix(strings.TrimPrefix(s, "+"), "-")
+	return strings.EqualFold(s, "inf")
+}
+
+// isBound reports whether s is a number or a version
+func isBound(s string) bool {
+	if _, err := parseNumber(s); err == nil {
+		return true
+	}
+	_, err := parseVersion(s)
+	return err == nil
+}
+
+// range: [18, 35), (0, 13], [2.5, +inf), [3.0, 4.0)
+func (p *parser) parseRange() (*Range, error) {
+	start := p.pos
+	r := &Range{MinIncl: p.peek() == '['}
+	p.next()
+
+	scanBound := func() (string, error) {
+		p.skipSpace()
+		pos := p.pos
+		tok := p.scan(func(r rune) bool {
+			return unicode.IsSpace(r) || r == ',' || r == ']' || r == ')'
+		})
+		if tok == "" {
+			return "", p.errorAt(pos, "number", "version")
+		}
+		if isInfBound(tok) {
+			return "", nil
+		}
+		if !isBound(tok) {
+			return "", p.errorAt(pos, "number", "version")
+		}
+		return tok, nil
+	}
+
+	var err error
+	if r.Min, err = scanBound(); err != nil {
+		return nil, err
+	}
+	if p.skipSpace(); p.peek() != ',' {
+		return nil, p.errorAt(p.pos, ",")
+	}
+	p.next()
+	if r.Max, err = scanBound(); err != nil {
+		return nil, err
+	}
+	p.skipSpace()
+	switch p.peek() {
+	case ']':
+		r.MaxIncl = true
+	case ')':
+	default:
+		return nil, p.errorAt(p.pos, "]", ")")
+	}
+	p.next()
+
+	if msg, ok := r.check(r.keyType()); !ok {
+		perr := p.errorAt(start)
+		perr.Msg = msg
+		return nil, perr
+	}
+	return r, nil
+}
+
+// comparison: age > 60, bidfloor <= 2.5, app_version >= 5.2.1
+func (p *parser) parseComparison(op string) (*Range, error) {
+	p.skipSpace()
+	pos := p.pos
+	tok, err := p.literal(p.word, "number")
+	if err != nil {
+		return nil, err
+	}
+	if !isBound(tok) {
+		return nil, p.errorAt(pos, "number", "version")
+	}
+	switch op {
+	case "<":
+		return &Range{Max: tok}, nil
+	case "<=":
+		return &Range{Max: tok, MaxIncl: true}, nil
+	case ">":
+		return &Range{Min: tok}, nil
+	default: // ">="
+		return &Range{Min: tok, MinIncl: true}, nil
+	}
+}
+
+func isComparison(op string) bool {
+	return op == "<" || op == "<=" || op == ">" || op == ">="
+}
+
+type numInterval struct {
+	lo, hi         bound // nil means unbounded
+	loIncl, hiIncl bool
+	termId         int
+}
+
+func newNumInterval(r *Range, lo, hi bound, termId int) numInterval {
+	return numInterval{lo: lo, hi: hi, loIncl: r.MinIncl, hiIncl: r.MaxIncl, termId: termId}
+}
+
+func (iv *numInterval) contains(x bound) bool {
+	if iv.lo != nil {
+		if c := iv.lo.compare(x); c > 0 || (c == 0 && !iv.loIncl) {
+			return false
+		}
+	}
+	if iv.hi != nil {
+		if c := x.compare(iv.hi); c > 0 || (c == 0 && !iv.hiIncl) {
+			return false
+		}
+	}
+	return true
+}
+
+// loAbove reports whether lower bound lo is above x, nil lo is -inf
+func loAbove(lo, x bound) bool {
+	return lo != nil && lo.compare(x) > 0
+}
+
+// hiBelow reports whether upper bound hi is below x, nil hi is +inf
+func hiBelow(hi, x bound) bool {
+	return hi != nil && hi.compare(x) < 0
+}
+
+// numIndex indexes intervals of a key, whose values are numbers or versions by typ,
+// intervals are sorted by lo and maxHi[i] is the max hi of intervals[:i+1],
+// so a lookup only visits intervals whose lo <= x and stops when no interval before can reach x
+type numIndex struct {
+	typ       KeyType
+	intervals []numInterval
+	maxHi     []bound
+	termIds   map[int]bool
+}
+
+func newNumIndex(typ KeyType) *numIndex {
+	return &numIndex{typ: typ, termIds: make(map[int]bool)}
+}
+
+func (idx *numIndex) add(iv numInterval) {
+	if idx.termIds[iv.termId] {
+		return
+	}
+	idx.termIds[iv.termId] = true
+
+	pos := sort.Search(len(idx.intervals), func(i int) bool {
+		if iv.lo == nil {
+			return idx.intervals[i].lo != nil
+		}
+		return loAbove(idx.intervals[i].lo, iv.lo)
+	})
+	idx.intervals = append(idx.intervals, numInterval{})
+	copy(idx.intervals[pos+1:], idx.intervals[pos:])
+	idx.intervals[pos] = iv
+
+	idx.maxHi = append(idx.maxHi, nil)
+	for i := pos; i < len(idx.intervals); i++ {
+		idx.maxHi[i] = idx.intervals[i].hi
+		if i > 0 && (idx.maxHi[i-1] == nil || (idx.maxHi[i] != nil && idx.maxHi[i-1].compare(idx.maxHi[i]) > 0)) {
+			idx.maxHi[i] = idx.maxHi[i-1]
+		}
+	}
+}
+
+// lookup appends ids of terms whose interval contains x to ids
+func (idx *numIndex) lookup(x bound, ids []int) []int {
+	n := sort.Search(len(idx.intervals), func(i int) bool { return loAbove(idx.intervals[i].lo, x) })
+	for i := n - 1; i >= 0 && !hiBelow(idx.maxHi[i], x); i-- {
+		if idx.intervals[i].contains(x) {
+			ids = append(ids, idx.intervals[i].termId)
+		}
+	}
+	return ids
+}
+
+// rangeIndexAdd indexes range term of key, r should be a valid range of the key type
+func (h *Handler) rangeIndexAdd(key string, r *Range, termId int) error {
+	h.rangesLock.Lock()
+	defer h.rangesLock.Unlock()
+	idx, ok := h.ranges[key]
+	typ := h.keyTypes[key]
+	if ok {
+		typ = idx.typ
+	}
+	lo, hi, err := r.bounds(typ)
+	if err != nil {
+		return err
+	}
+	if !ok {
+		idx = newNumIndex(typ)
+		h.ranges[key] = idx
+	}
+	idx.add(newNumInterval(r, lo, hi, termId))
+	return nil
+}
+
+// rangeLookup appends ids of range terms matched by conds to termids
+func (h *Handler) rangeLookup(conds []Cond, termids []int) []int {
+	h.rangesLock.RLock()
+	defer h.rangesLock.RUnlock()
+	if len(h.ranges) == 0 {
+		return termids
+	}
+	for i := range conds {
+		idx, ok := h.ranges[conds[i].Key]
+		if !ok {
+			continue
+		}
+		if x, err := parseBound(idx.typ, conds[i].Val); err == nil {
+			termids = idx.lookup(x, termids)
+		}
+	}
+	return termids
+}
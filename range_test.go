@@ -0,0 +1,164 @@
+package godnf_test
+
+import (
+	"sort"
+	"strconv"
+	"testing"
+
+	dnf "github.com/brg-liuwei/godnf"
+)
+
+func TestParseRange(t *testing.T) {
+	setDelim()
+	for _, c := range []struct {
+		dnf      string
+		expected string
+	}{
+		{"(age in [18, 35) and region in {SH})", "(age in [18, 35) and region in {SH})"},
+		{"(age not in (0, 13])", "(age not in (0, 13])"},
+		{"(bidfloor <= 2.5)", "(bidfloor <= 2.5)"},
+		{"(age > 60) or (age < 13)", "(age > 60) or (age < 13)"},
+		{"(age in [18, +inf))", "(age >= 18)"},
+		{"(age not in (-inf, 18))", "(age not in (-inf, 18))"},
+		{"(age in [ 18 , 18 ])", "(age in [18, 18])"},
+	} {
+		expr, err := dnf.ParseDNF(c.dnf)
+		if err != nil {
+			t.Errorf("unexpected error when ParseDNF %q: %v", c.dnf, err)
+			continue
+		}
+		if got := expr.String(); got != c.expected {
+			t.Errorf("unexpected dnf of %q: %s", c.dnf, got)
+		}
+	}
+
+	for _, s := range []string{
+		"(age in [18, 35)",
+		"(age in [18 35))",
+		"(age in [18, abc))",
+		"(age in [35, 18))",
+		"(age in (18, 18])",
+		"(age > abc)",
+		"(age >= )",
+	} {
+		if err := dnf.DnfCheck(s); err == nil {
+			t.Error("expect error when DnfCheck: ", s)
+		}
+	}
+}
+
+func TestRangeRetrieval(t *testing.T) {
+	h := createDnfHandler([]string{
+		"(age in [18, 35) and region in {SH})",   // docid: 0
+		"(age > 60)",                             // docid: 1
+		"(bidfloor <= 2.5)",                      // docid: 2
+		"(age not in [0, 13))",                   // docid: 3
+		"(age in [18.0, 35) and region in {SH})", // docid: 4, the same range term as docid 0
+	}, false)
+
+	search := func(conds ...dnf.Cond) string {
+		docs, err := h.SearchAll(conds)
+		if err != nil {
+			t.Fatal("unexpected error when Search: ", err)
+		}
+		ids := make([]int, 0, len(docs))
+		for _, doc := range docs {
+			a, err := h.DocId2Attr(doc)
+			if err != nil {
+				t.Fatal("unexpected error when DocId2Attr: ", err)
+			}
+			ids = append(ids, a.(attr).docId)
+		}
+		sort.Ints(ids)
+		s := ""
+		for _, id := range ids {
+			s += strconv.Itoa(id) + " "
+		}
+		return s
+	}
+
+	for _, c := range []struct {
+		conds    []dnf.Cond
+		expected string
+	}{
+		{[]dnf.Cond{{"age", "18"}, {"region", "SH"}}, "0 3 4 "},
+		{[]dnf.Cond{{"age", "35"}, {"region", "SH"}}, "3 "},
+		{[]dnf.Cond{{"age", "20.5"}}, "3 "},
+		{[]dnf.Cond{{"age", "60"}}, "3 "},
+		{[]dnf.Cond{{"age", "61"}}, "1 3 "},
+		{[]dnf.Cond{{"age", "12"}}, ""},
+		{[]dnf.Cond{{"age", "abc"}}, "3 "},
+		{[]dnf.Cond{{"bidfloor", "2.5"}}, "2 3 "},
+		{[]dnf.Cond{{"bidfloor", "2.51"}}, "3 "},
+	} {
+		if got := search(c.conds...); got != c.expected {
+			t.Errorf("unexpected docs of %v: %q, expect %q", c.conds, got, c.expected)
+		}
+	}
+}
+
+func TestBoolExprRange(t *testing.T) {
+	setDelim()
+	for _, c := range []struct {
+		s        string
+		expected string
+	}{
+		{"age >= 18 and age < 35", "(age in [18, 35))"},
+		{"age in [0, 100] and not age in [13, 18)", "(age in [0, 100] and age not in [13, 18))"},
+		{"age in {3, 20, abc} and age >= 18", "(age in {20})"},
+		{"age in {3, 20, abc} and age not in [18, 35)", "(age in {3, abc})"},
+		{"age > 60 or age <= 13", "(age > 60) or (age <= 13)"},
+		{"not age > 60", "(age not in (60, +inf))"},
+	} {
+		b, err := dnf.ParseBoolExpr(c.s)
+		if err != nil {
+			t.Errorf("unexpected error when ParseBoolExpr %q: %v", c.s, err)
+			continue
+		}
+		expr, err := b.DNF(dnf.DefaultMaxConjunctions)
+		if err != nil {
+			t.Errorf("unexpected error when DNF %q: %v", c.s, err)
+			continue
+		}
+		if got := expr.String(); got != c.expected {
+			t.Errorf("dnf of %q:\n  got:    %s\n  expect: %s", c.s, got, c.expected)
+		}
+	}
+
+	if b, err := dnf.ParseBoolExpr("age > 60 and age < 18"); err != nil {
+		t.Error("unexpected error when ParseBoolExpr: ", err)
+	} else if _, err := b.DNF(dnf.DefaultMaxConjunctions); err == nil {
+		t.Error("expect error when DNF an expression never matched")
+	}
+}
+
+func TestRangeJSON(t *testing.T) {
+	setDelim()
+	s := "(age in [18, 35) and bidfloor <= 2.5)"
+	expected := `{"or":[{"and":[{"key":"age","in_range":{"gte":"18","lt":"35"}},{"key":"bidfloor","in_range":{"lte":"2.5"}}]}]}`
+
+	b, err := dnf.DNFToJSON(s)
+	if err != nil {
+		t.Fatal("unexpected error when DNFToJSON: ", err)
+	}
+	if string(b) != expected {
+		t.Error("unexpected json: ", string(b))
+	}
+	back, err := dnf.JSONToDNF(b)
+	if err != nil {
+		t.Fatal("unexpected error when JSONToDNF: ", err)
+	}
+	if back != s {
+		t.Error("unexpected dnf: ", back)
+	}
+
+	for _, j := range []string{
+		`{"or":[{"and":[{"key":"age","in_range":{"gt":"1","gte":"1"}}]}]}`,
+		`{"or":[{"and":[{"key":"age","in_range":{"gte":"35","lt":"18"}}]}]}`,
+		`{"or":[{"and":[{"key":"age","in":["3"],"not_in_range":{"lt":"18"}}]}]}`,
+	} {
+		if _, err := dnf.JSONToDNF([]byte(j)); err == nil {
+			t.Error("expect error when JSONToDNF: ", j)
+		}
+	}
+}
@@ -0,0 +1,297 @@
+package godnf
+
+import (
+	"encoding/json"
+	"errors"
+	"net"
+	"regexp"
+	"strconv"
+)
+
+// ValueType is the type of values of a key declared in Schema
+type ValueType string
+
+const (
+	StringType  ValueType = "string"  // any string, the default type
+	IntType     ValueType = "int"     // decimal integers like -3 or 18
+	VersionType ValueType = "version" // semantic versions like 5.2.1, ranges are compared as versions
+	IPType      ValueType = "ip"      // IPv4 or IPv6 addresses, which can be matched by cidr prefixes
+)
+
+// KeySchema declares a key of Schema
+type KeySchema struct {
+	Key     string    `json:"key"`
+	Type    ValueType `json:"type,omitempty"`
+	Values  []string  `json:"values,omitempty"`  // allowed values, any value of type is allowed if empty
+	Pattern string    `json:"pattern,omitempty"` // regular expression which values must match, if not ""
+	Multi   bool      `json:"multi,omitempty"`   // conds may have several values of this key
+
+	pattern *regexp.Regexp
+	values  map[string]bool
+}
+
+// Schema declares keys of docs and conds, see Handler.SetSchema:
+//
+//	{"keys": [{"key": "region", "values": ["SH", "BJ"]}, {"key": "age", "type": "int"},
+//	          {"key": "app", "pattern": "^[a-z.]+$", "multi": true}]}
+//
+// geo predicates, time windows and the location keys of conds are not declared
+type Schema struct {
+	Keys []KeySchema `json:"keys"`
+
+	// Flag, if not nil, is called with unknown keys and invalid values,
+	// which are accepted instead of rejected by AddDoc and Search
+	Flag func(err *SchemaError) `json:"-"`
+}
+
+// SchemaErrorKind is the kind of a SchemaError
+type SchemaErrorKind int
+
+const (
+	UnknownKeyError     SchemaErrorKind = iota // the key is not declared
+	InvalidValueError                          // the value is not of the type, not allowed or does not match the pattern
+	MultipleValuesError                        // conds have several values of a key which is not multi-valued
+)
+
+// SchemaError is returned by AddDoc and Search if docs or conds violate the schema of handler
+type SchemaError struct {
+	Kind SchemaErrorKind
+	Key  string
+	Val  string // the invalid value or bound, if any
+	Msg  string
+}
+
+func (e *SchemaError) Error() string {
+	return "schema error: " + e.Msg
+}
+
+// SetSchema set the schema of keys, it should be called before adding docs,
+// types of keys in ranges are set by the schema too, see SetKeyType
+func (h *Handler) SetSchema(schema *Schema) error {
+	s := &Schema{Keys: make([]KeySchema, 0, len(schema.Keys)), Flag: schema.Flag}
+	keys := make(map[string]*KeySchema, len(schema.Keys))
+	for _, ks := range schema.Keys {
+		if _, ok := keys[ks.Key]; ok {
+			return errors.New("key " + ks.Key + " duplicate in schema")
+		}
+		switch ks.Type {
+		case "":
+			ks.Type = StringType
+		case StringType, IntType, VersionType, IPType:
+		default:
+			return errors.New("unknown type " + string(ks.Type) + " of key " + ks.Key)
+		}
+		if ks.Pattern != "" {
+			pattern, err := regexp.Compile(ks.Pattern)
+			if err != nil {
+				return errors.New("invalid pattern of key " + ks.Key + ": " + err.Error())
+			}
+			ks.pattern = pattern
+		}
+		ks.values = nil
+		ks.Values = append([]string(nil), ks.Values...)
+		for _, val := range ks.Values {
+			if msg, ok := ks.checkType(val); !ok {
+				return errors.New("allowed " + msg)
+			}
+		}
+		if len(ks.Values) != 0 {
+			ks.values = make(map[string]bool, len(ks.Values))
+			for _, val := range ks.Values {
+				ks.values[val] = true
+			}
+		}
+		s.Keys = append(s.Keys, ks)
+		keys[ks.Key] = &s.Keys[len(s.Keys)-1]
+	}
+
+	h.rangesLock.Lock()
+	defer h.rangesLock.Unlock()
+	for key := range keys {
+		if err := h.keyTypeChangeable(key, keys[key].keyType()); err != nil {
+			return err
+		}
+	}
+	for key := range keys {
+		h.setKeyType(key, keys[key].keyType())
+	}
+	h.confLock.Lock()
+	h.schema, h.schemaKeys = s, keys
+	h.confLock.Unlock()
+	return nil
+}
+
+// Schema returns the schema of handler, or nil if it is not set
+func (h *Handler) Schema() *Schema {
+	s, _ := h.getSchema()
+	return s
+}
+
+// SchemaJSON returns the JSON of the schema of handler for frontends, or null if it is not set
+func (h *Handler) SchemaJSON() ([]byte, error) {
+	return json.Marshal(h.Schema())
+}
+
+// getSchema returns the schema of handler and its keys by name
+func (h *Handler) getSchema() (*Schema, map[string]*KeySchema) {
+	h.confLock.RLock()
+	defer h.confLock.RUnlock()
+	return h.schema, h.schemaKeys
+}
+
+// multiKey reports whether key is declared multi-valued by the schema of handler
+func (h *Handler) multiKey(key string) bool {
+	_, keys := h.getSchema()
+	ks, ok := keys[key]
+	return ok && ks.Multi
+}
+
+// keyType returns the type of ranges of ks
+func (ks *KeySchema) keyType() KeyType {
+	if ks.Type == VersionType {
+		return VersionKey
+	}
+	return NumberKey
+}
+
+// checkType returns false and the reason if val is not a value of the type of ks
+func (ks *KeySchema) checkType(val string) (msg string, ok bool) {
+	switch ks.Type {
+	case IntType:
+		_, err := strconv.ParseInt(val, 10, 64)
+		ok = err == nil
+	case VersionType:
+		_, err := parseVersion(val)
+		ok = err == nil
+	case IPType:
+		ok = net.ParseIP(val) != nil
+	default:
+		ok = true
+	}
+	return "value " + val + " of key " + ks.Key + " is not " + string(ks.Type), ok
+}
+
+// checkValue returns false and the reason if val is not a valid value of ks
+func (ks *KeySchema) checkValue(val string) (msg string, ok bool) {
+	if msg, ok := ks.checkType(val); !ok {
+		return msg, false
+	}
+	if ks.values != nil && !ks.values[val] {
+		return "value " + val + " of key " + ks.Key + " is not allowed", false
+	}
+	if ks.pattern != nil && !ks.pattern.MatchString(val) {
+		return "value " + val + " of key " + ks.Key + " does not match " + ks.Pattern, false
+	}
+	return "", true
+}
+
+// violation rejects err, or flags it and returns nil if the schema has Flag
+func (s *Schema) violation(err *SchemaError) error {
+	if s.Flag == nil {
+		return err
+	}
+	s.Flag(err)
+	return nil
+}
+
+// schemaCheck returns a *SchemaError if expr violates the schema of handler
+func (h *Handler) schemaCheck(expr *Expr) error {
+	schema, schemaKeys := h.getSchema()
+	if schema == nil {
+		return nil
+	}
+	for _, conj := range expr.Conjs {
+		for _, amt := range conj.Amts {
+			if amt.Geo != nil || amt.Week != nil {
+				continue
+			}
+			var errs []*SchemaError
+			if ks, ok := schemaKeys[amt.Key]; ok && amt.NamedSet != "" {
+				// values of the set are checked as values of the key
+				errs = ks.checkVals(h.setValues(amt.Key, amt.NamedSet))
+			} else if ok {
+				errs = ks.checkAmt(amt)
+			} else {
+				errs = append(errs, &SchemaError{Kind: UnknownKeyError, Key: amt.Key, Msg: "unknown key " + amt.Key})
+			}
+			for _, err := range errs {
+				if err := schema.violation(err); err != nil {
+					return err
+				}
+			}
+		}
+	}
+	return nil
+}
+
+// checkAmt returns violations of amt of the key of ks
+func (ks *KeySchema) checkAmt(amt *Assignment) []*SchemaError {
+	invalid := func(val, msg string) *SchemaError {
+		return &SchemaError{Kind: InvalidValueError, Key: ks.Key, Val: val, Msg: msg}
+	}
+	switch {
+	case amt.Bucket != nil, amt.Exists:
+		return nil
+	case amt.CIDR && ks.Type != IPType:
+		return []*SchemaError{invalid("", "key "+ks.Key+" of type "+string(ks.Type)+" can not be in cidr")}
+	case amt.CIDR:
+		return nil
+	case amt.Range != nil && (ks.Type == StringType || ks.Type == IPType):
+		return []*SchemaError{invalid("", "key "+ks.Key+" of type "+string(ks.Type)+" can not be in range")}
+	}
+
+	var errs []*SchemaError
+	if amt.Range != nil {
+		// bounds of ranges may be any value of type
+		for _, s := range []string{amt.Range.Min, amt.Range.Max} {
+			if msg, ok := ks.checkType(s); s != "" && !isInfBound(s) && !ok {
+				errs = append(errs, invalid(s, msg))
+			}
+		}
+		return errs
+	}
+	return ks.checkVals(amt.Vals)
+}
+
+// checkVals returns violations of values of the key of ks
+func (ks *KeySchema) checkVals(vals []string) []*SchemaError {
+	var errs []*SchemaError
+	for _, val := range vals {
+		if msg, ok := ks.checkValue(val); !ok {
+			errs = append(errs, &SchemaError{Kind: InvalidValueError, Key: ks.Key, Val: val, Msg: msg})
+		}
+	}
+	return errs
+}
+
+// schemaCondCheck returns a *SchemaError if conds violate the schema of handler
+func (h *Handler) schemaCondCheck(conds []Cond) error {
+	schema, schemaKeys := h.getSchema()
+	if schema == nil {
+		return nil
+	}
+	counts := make(map[string]int, len(conds))
+	for i := range conds {
+		key, val := conds[i].Key, conds[i].Val
+		ks, ok := schemaKeys[key]
+		var errs []*SchemaError
+		switch counts[key]++; {
+		case ok:
+			if counts[key] == 2 && !ks.Multi {
+				errs = append(errs, &SchemaError{Kind: MultipleValuesError, Key: key, Msg: "key " + key + " has several values"})
+			}
+			if msg, ok := ks.checkValue(val); !ok {
+				errs = append(errs, &SchemaError{Kind: InvalidValueError, Key: key, Val: val, Msg: msg})
+			}
+		case key == GeoLatKey || key == GeoLonKey:
+		case counts[key] == 1:
+			errs = append(errs, &SchemaError{Kind: UnknownKeyError, Key: key, Msg: "unknown key " + key})
+		}
+		for _, err := range errs {
+			if err := schema.violation(err); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,162 @@
+package godnf_test
+
+import (
+	"encoding/json"
+	"testing"
+
+	dnf "github.com/brg-liuwei/godnf"
+)
+
+const testSchema = `{"keys":[{"key":"region","values":["SH","BJ","GZ"]},{"key":"age","type":"int"},` +
+	`{"key":"ver","type":"version"},{"key":"ip","type":"ip"},{"key":"app","pattern":"^[a-z.]+$","multi":true}]}`
+
+func newSchemaHandler(t *testing.T) *dnf.Handler {
+	var schema dnf.Schema
+	if err := json.Unmarshal([]byte(testSchema), &schema); err != nil {
+		t.Fatal("unexpected error when Unmarshal schema: ", err)
+	}
+	h := dnf.NewHandler()
+	if err := h.SetSchema(&schema); err != nil {
+		t.Fatal("unexpected error when SetSchema: ", err)
+	}
+	return h
+}
+
+func TestSchemaAddDoc(t *testing.T) {
+	setDelim()
+	h := newSchemaHandler(t)
+	for i, c := range []struct {
+		dnf  string
+		kind dnf.SchemaErrorKind
+		ok   bool
+	}{
+		{"(region in {SH} and age in [18, 35) and ver >= 5.2.1 and ip in cidr {10.0.0.0/8})", 0, true},
+		{"(app in {com.example} and has ver and bucket(region, 100) < 10)", 0, true},
+		{"(regoin in {SH})", dnf.UnknownKeyError, false},
+		{"(region in {SH, HK})", dnf.InvalidValueError, false},
+		{"(age in {x})", dnf.InvalidValueError, false},
+		{"(age in [18.5, 35))", dnf.InvalidValueError, false},
+		{"(region in [1, 2))", dnf.InvalidValueError, false},
+		{"(region in cidr {10.0.0.0/8})", dnf.InvalidValueError, false},
+		{"(ip in {10.0.0.x})", dnf.InvalidValueError, false},
+		{"(app not in {Com.Example})", dnf.InvalidValueError, false},
+		{"(geo within {31.23, 121.47, 5km} and time in week {Mon})", 0, true},
+	} {
+		err := h.AddDoc("doc", string(rune('a'+i)), c.dnf, attr{i, "doc"})
+		if c.ok {
+			if err != nil {
+				t.Errorf("unexpected error when AddDoc %q: %v", c.dnf, err)
+			}
+			continue
+		}
+		if serr, ok := err.(*dnf.SchemaError); !ok || serr.Kind != c.kind {
+			t.Errorf("expect schema error of kind %d when AddDoc %q, got %v", c.kind, c.dnf, err)
+		}
+	}
+}
+
+func TestSchemaNamedSet(t *testing.T) {
+	setDelim()
+	h := newSchemaHandler(t)
+	h.RegisterSet("adults", []string{"18", "19"})
+	h.RegisterSet("cities", []string{"SH", "HK"})
+	if err := h.AddDoc("doc", "0", "(age in @adults)", attr{0, "doc"}); err != nil {
+		t.Fatal("unexpected error when AddDoc: ", err)
+	}
+	err := h.AddDoc("doc", "1", "(region in @cities)", attr{1, "doc"})
+	if serr, ok := err.(*dnf.SchemaError); !ok || serr.Kind != dnf.InvalidValueError || serr.Val != "HK" {
+		t.Error("expect InvalidValueError of HK when AddDoc, got ", err)
+	}
+
+	// sets referenced by docs are checked when they are replaced
+	err = h.RegisterSet("adults", []string{"18", "x"})
+	if serr, ok := err.(*dnf.SchemaError); !ok || serr.Kind != dnf.InvalidValueError || serr.Val != "x" {
+		t.Error("expect InvalidValueError of x when RegisterSet, got ", err)
+	}
+	if docs, _ := h.SearchAll([]dnf.Cond{{"age", "19"}}); !sameDocs(h, docs, []int{0}) {
+		t.Error("unexpected docs after RegisterSet failed: ", docs)
+	}
+	if err := h.RegisterSet("cities", []string{"x"}); err != nil {
+		t.Error("unexpected error when RegisterSet a set not referenced: ", err)
+	}
+}
+
+func TestSchemaSearch(t *testing.T) {
+	h := newSchemaHandler(t)
+	if err := h.AddDoc("doc", "0", "(region in {SH} and app in {a.b})", attr{0, "doc"}); err != nil {
+		t.Fatal("unexpected error when AddDoc: ", err)
+	}
+	for _, c := range []struct {
+		conds []dnf.Cond
+		kind  dnf.SchemaErrorKind
+		ok    bool
+	}{
+		{[]dnf.Cond{{"region", "SH"}, {"app", "a.b"}, {"lat", "31.2"}}, 0, true},
+		{[]dnf.Cond{{"regoin", "SH"}}, dnf.UnknownKeyError, false},
+		{[]dnf.Cond{{"region", "SH"}, {"region", "BJ"}}, dnf.MultipleValuesError, false},
+		{[]dnf.Cond{{"age", "old"}}, dnf.InvalidValueError, false},
+	} {
+		docs, err := h.SearchAll(c.conds)
+		if c.ok {
+			if err != nil || len(docs) != 1 {
+				t.Errorf("unexpected result when Search %v: %v, %v", c.conds, docs, err)
+			}
+			continue
+		}
+		if serr, ok := err.(*dnf.SchemaError); !ok || serr.Kind != c.kind {
+			t.Errorf("expect schema error of kind %d when Search %v, got %v", c.kind, c.conds, err)
+		}
+	}
+}
+
+func TestSchemaFlag(t *testing.T) {
+	var schema dnf.Schema
+	json.Unmarshal([]byte(testSchema), &schema)
+	var flagged []*dnf.SchemaError
+	schema.Flag = func(err *dnf.SchemaError) { flagged = append(flagged, err) }
+	h := dnf.NewHandler()
+	if err := h.SetSchema(&schema); err != nil {
+		t.Fatal("unexpected error when SetSchema: ", err)
+	}
+
+	if err := h.AddDoc("doc", "0", "(regoin in {SH} and region in {HK})", attr{0, "doc"}); err != nil {
+		t.Fatal("unexpected error when AddDoc: ", err)
+	}
+	docs, err := h.SearchAll([]dnf.Cond{{"regoin", "SH"}, {"region", "HK"}})
+	if err != nil || len(docs) != 1 {
+		t.Errorf("unexpected result when Search: %v, %v", docs, err)
+	}
+	if len(flagged) != 4 || flagged[0].Kind != dnf.UnknownKeyError || flagged[1].Val != "HK" {
+		t.Error("unexpected flagged errors: ", flagged)
+	}
+}
+
+func TestSchemaJSON(t *testing.T) {
+	h := dnf.NewHandler()
+	if b, err := h.SchemaJSON(); err != nil || string(b) != "null" {
+		t.Error("unexpected json of no schema: ", string(b), err)
+	}
+	h = newSchemaHandler(t)
+	b, err := h.SchemaJSON()
+	if err != nil {
+		t.Fatal("unexpected error when SchemaJSON: ", err)
+	}
+	expected := `{"keys":[{"key":"region","type":"string","values":["SH","BJ","GZ"]},{"key":"age","type":"int"},` +
+		`{"key":"ver","type":"version"},{"key":"ip","type":"ip"},{"key":"app","type":"string","pattern":"^[a-z.]+$","multi":true}]}`
+	if string(b) != expected {
+		t.Error("unexpected json of schema: ", string(b))
+	}
+
+	for _, s := range []string{
+		`{"keys":[{"key":"a"},{"key":"a"}]}`,
+		`{"keys":[{"key":"a","type":"float"}]}`,
+		`{"keys":[{"key":"a","pattern":"("}]}`,
+		`{"keys":[{"key":"a","type":"int","values":["x"]}]}`,
+	} {
+		var schema dnf.Schema
+		json.Unmarshal([]byte(s), &schema)
+		if err := h.SetSchema(&schema); err == nil {
+			t.Error("expect error when SetSchema: ", s)
+		}
+	}
+}
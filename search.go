@@ -4,6 +4,7 @@ import (
 	"errors"
 	"fmt"
 	"sort"
+	"time"
 
 	"github.com/brg-liuwei/godnf/set"
 )
@@ -30,6 +31,9 @@ import (
 //     Key: "Country",
 //     Val: "US",
 // }
+//
+// A key with several values, like interests of a user, is several Conds of the key,
+// which match ∈ if any value is in the set, and violate ∉ if any value is in the set
 type Cond struct {
 	Key string
 	Val string
@@ -45,7 +49,8 @@ func searchCondCheck(conds []Cond) error {
 	}
 	m := make(map[string]bool)
 	for _, cond := range conds {
-		if _, ok := m[cond.Key]; ok {
+		// a location has only one value of each coordinate
+		if _, ok := m[cond.Key]; ok && (cond.Key == GeoLatKey || cond.Key == GeoLonKey) {
 			return errors.New("duplicate keys: " + cond.Key)
 		}
 		m[cond.Key] = true
@@ -60,19 +65,49 @@ func (h *Handler) GetDocSize() int {
 	return len(h.docs.docs)
 }
 
+// SearchOptions are options of SearchWithOptions
+type SearchOptions struct {
+	Time time.Time // time of time predicates, the clock of handler is used if Time is zero
+}
+
 // Search docs which match conds and passed by attrFilter
 func (h *Handler) Search(conds []Cond, attrFilter func(DocAttr) bool) (docs []int, err error) {
+	return h.SearchWithOptions(conds, attrFilter, SearchOptions{})
+}
+
+// SearchWithOptions searches docs which match conds and passed by attrFilter with opts
+func (h *Handler) SearchWithOptions(conds []Cond, attrFilter func(DocAttr) bool, opts SearchOptions) (docs []int, err error) {
+	conds = h.normalizeConds(conds)
+	if err := h.schemaCondCheck(conds); err != nil {
+		return nil, err
+	}
 	if err := searchCondCheck(conds); err != nil {
 		return nil, err
 	}
+	conds = h.expandConds(conds)
 	termids := make([]int, 0)
 	h.termMapLock.RLock()
 	for i := 0; i < len(conds); i++ {
 		if id, ok := h.termMap[conds[i].Key+"%"+conds[i].Val]; ok {
 			termids = append(termids, id)
 		}
+		if id, ok := h.termMap[(&Term{key: conds[i].Key, kind: existsTerm}).mapKey()]; ok {
+			termids = append(termids, id)
+		}
+		if h.underKeys[conds[i].Key] {
+			termids = h.underLookup(&conds[i], termids)
+		}
 	}
 	h.termMapLock.RUnlock()
+	termids = h.rangeLookup(conds, termids)
+	termids = h.bucketLookup(conds, termids)
+	termids = h.namedSetLookup(conds, termids)
+	termids = h.cidrLookup(conds, termids)
+	termids = h.geoLookup(conds, termids)
+	if opts.Time.IsZero() {
+		opts.Time = h.now()
+	}
+	termids = h.weekLookup(opts.Time, termids)
 	return h.doSearch(termids, attrFilter), nil
 }
 
@@ -118,7 +153,8 @@ func (h *Handler) getConjs(terms []int) (conjs []int) {
 	h.conjSzRvsLock.RLock()
 	defer h.conjSzRvsLock.RUnlock()
 
-	n := len(terms)
+	// a term may be shared by several assignments of a conjunction
+	n := len(terms) * h.termShare
 	ASSERT(len(h.conjSzRvs) > 0)
 	if n >= len(h.conjSzRvs) {
 		n = len(h.conjSzRvs) - 1
@@ -128,6 +164,10 @@ func (h *Handler) getConjs(terms []int) (conjs []int) {
 
 	conjSet := set.NewIntSet()
 
+	// an assignment is counted once, though several of its terms may be found,
+	// like paths of k under {CN, CN/SH} found by CN/SH/Pudong
+	counted := make(map[cPair]bool)
+
 	for i := 0; i <= n; i++ {
 		termlist := h.conjSzRvs[i]
 		if termlist == nil || len(termlist) == 0 {
@@ -144,6 +184,10 @@ func (h *Handler) getConjs(terms []int) (conjs []int) {
 				termlist[idx].cList != nil {
 
 				for _, pair := range termlist[idx].cList {
+					if pair.belong && counted[pair] {
+						continue
+					}
+					counted[pair] = true
 					countSet.Add(pair.conjId, pair.belong, false)
 				}
 			}
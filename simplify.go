@@ -0,0 +1,121 @@
+package godnf
+
+// SimplifyDNF simplifies dnf with the default syntax without changing which conds match it:
+//
+//	(region in {SH} and age in [18, 35)) or (region in {SH}) --> (region in {SH})
+//	(region in {SH} and os in {ios}) or (region in {BJ} and os in {ios}) --> (region in {SH, BJ} and os in {ios})
+//
+// conjunctions which can never be matched or are subsumed by others are removed,
+// and conjunctions which differ in only one set are merged
+func SimplifyDNF(dnf string) (string, error) {
+	expr, err := ParseDNF(dnf)
+	if err != nil {
+		return "", err
+	}
+	if expr, err = expr.simplify(nil, nil); err != nil {
+		return "", err
+	}
+	return expr.String(), nil
+}
+
+// AddOptions are options of AddDocWithOptions
+type AddOptions struct {
+	// Simplify simplifies the dnf before indexing, see SimplifyDNF,
+	// GetDnf still returns the dnf as added
+	Simplify bool
+}
+
+// simplify returns the simplified expr, see SimplifyDNF,
+// keyType tells the types of range keys, which are inferred if it is nil,
+// and multi tells keys which conds may have several values of, see mergeAmts
+func (expr *Expr) simplify(keyType func(string) KeyType, multi func(string) bool) (*Expr, error) {
+	conjs := make([]*Conjunction, 0, len(expr.Conjs))
+	for _, conj := range expr.Conjs {
+		if amts, ok := mergeAmts(conj.Amts, keyType, multi); ok {
+			conjs = append(conjs, &Conjunction{Pos: conj.Pos, Amts: amts})
+		}
+	}
+	if len(conjs) == 0 {
+		return nil, neverMatchError
+	}
+
+	for changed := true; changed; {
+		changed = false
+		conjs = removeSubsumed(conjs, keyType, multi)
+		for i := 0; i < len(conjs); i++ {
+			for j := i + 1; j < len(conjs); j++ {
+				if amts := mergeConjs(conjs[i].Amts, conjs[j].Amts); amts != nil {
+					conjs[i] = &Conjunction{Pos: conjs[i].Pos, Amts: amts}
+					conjs = append(conjs[:j], conjs[j+1:]...)
+					j--
+					changed = true
+				}
+			}
+		}
+	}
+	return &Expr{Conjs: conjs}, nil
+}
+
+// removeSubsumed removes conjunctions subsumed by others, the first of equivalent conjunctions is kept
+func removeSubsumed(conjs []*Conjunction, keyType func(string) KeyType, multi func(string) bool) []*Conjunction {
+	rc := make([]*Conjunction, 0, len(conjs))
+	for i, a := range conjs {
+		subsumed := false
+		for j, b := range conjs {
+			if i != j && subsumes(b.Amts, a.Amts, keyType, multi) && (j < i || !subsumes(a.Amts, b.Amts, keyType, multi)) {
+				subsumed = true
+				break
+			}
+		}
+		if !subsumed {
+			rc = append(rc, a)
+		}
+	}
+	return rc
+}
+
+// mergeConjs merges conjunctions a and b which differ in only one set of values:
+//
+//	(k in A and X) or (k in B and X) --> (k in A ∪ B and X)
+//
+// it returns nil if they can not be merged, a and b are merged by mergeAmts
+func mergeConjs(a, b []*Assignment) []*Assignment {
+	if len(a) != len(b) {
+		return nil
+	}
+	diff := -1
+	var other *Assignment
+	for i, x := range a {
+		var y *Assignment
+		for _, amt := range b {
+			if amt.target() == x.target() {
+				y = amt
+				break
+			}
+		}
+		switch {
+		case y == nil:
+			return nil
+		case amtString(x) == amtString(y):
+			continue
+		case diff >= 0 || !x.Belong || !y.Belong || !x.plainSet() || !y.plainSet() ||
+			x.Under != y.Under || x.CIDR != y.CIDR:
+			return nil
+		}
+		diff, other = i, y
+	}
+	if diff < 0 {
+		return nil
+	}
+
+	merged := append([]*Assignment(nil), a...)
+	cp := *a[diff]
+	cp.Vals = append(append([]string(nil), a[diff].Vals...), filterVals(other.Vals, a[diff].Vals, false)...)
+	merged[diff] = &cp
+	return merged
+}
+
+// plainSet reports whether amt is a set of values, paths or prefixes
+func (amt *Assignment) plainSet() bool {
+	return amt.Range == nil && amt.Geo == nil && amt.Week == nil && !amt.Exists && amt.NamedSet == ""
+}
@@ -0,0 +1,80 @@
+package godnf_test
+
+import (
+	"encoding/json"
+	"testing"
+
+	dnf "github.com/brg-liuwei/godnf"
+)
+
+func TestSimplifyDNF(t *testing.T) {
+	setDelim()
+	for _, c := range []struct {
+		dnf      string
+		expected string
+	}{
+		{"(region in {SH})", "(region in {SH})"},
+		{"(region in {SH} and age in [18, 35)) or (region in {SH})", "(region in {SH})"},
+		{"(region in {SH}) or (region in {SH, BJ}) or (region in {BJ, SH})", "(region in {SH, BJ})"},
+		{"(region in {SH} and os in {ios}) or (region in {BJ} and os in {ios})", "(region in {SH, BJ} and os in {ios})"},
+		{"(region in {SH} and os in {ios}) or (os in {ios} and region in {BJ}) or (region in {GZ} and os in {android})",
+			"(region in {SH, BJ} and os in {ios}) or (region in {GZ} and os in {android})"},
+		{"(region in {SH} and os in {ios}) or (region in {BJ} and os in {android})",
+			"(region in {SH} and os in {ios}) or (region in {BJ} and os in {android})"},
+		{"(region not in {SH} and os in {ios}) or (region not in {BJ} and os in {ios})",
+			"(region not in {SH} and os in {ios}) or (region not in {BJ} and os in {ios})"},
+		{"(region in {SH} and age in [18, 35)) or (region in {BJ} and age in [18, 35)) or (region in {SH} and age in [20, 30))",
+			"(region in {SH, BJ} and age in [18, 35))"},
+		{"(region in {SH} and gps not in {1}) or (region in {SH} and has gps)", "(region in {SH} and gps not in {1}) or (region in {SH} and has gps)"},
+		{"(region in {SH}) or (has region)", "(has region)"},
+		{"(region in {SH} and os in {ios}) or (region not in {BJ})", "(region not in {BJ})"},
+		{"(age in [18, 30)) or (age not in [40, 50))", "(age not in [40, 50))"},
+	} {
+		got, err := dnf.SimplifyDNF(c.dnf)
+		if err != nil {
+			t.Errorf("unexpected error when SimplifyDNF %q: %v", c.dnf, err)
+			continue
+		}
+		if got != c.expected {
+			t.Errorf("simplified dnf of %q:\n  got:    %s\n  expect: %s", c.dnf, got, c.expected)
+		}
+	}
+
+	if _, err := dnf.SimplifyDNF("(region in {SH}"); err == nil {
+		t.Error("expect error when SimplifyDNF invalid dnf")
+	}
+}
+
+func TestAddDocSimplified(t *testing.T) {
+	s := "(region in {SH} and os in {ios}) or (region in {BJ} and os in {ios}) or (region in {SH} and os in {ios} and age in [18, 35))"
+	h := dnf.NewHandler()
+	if err := h.AddDocWithOptions("doc", "0", s, attr{0, "doc"}, dnf.AddOptions{Simplify: true}); err != nil {
+		t.Fatal("unexpected error when AddDocWithOptions: ", err)
+	}
+
+	for _, c := range []struct {
+		conds    []dnf.Cond
+		expected []int
+	}{
+		{[]dnf.Cond{{"region", "SH"}, {"os", "ios"}}, []int{0}},
+		{[]dnf.Cond{{"region", "BJ"}, {"os", "ios"}, {"age", "20"}}, []int{0}},
+		{[]dnf.Cond{{"region", "GZ"}, {"os", "ios"}}, []int{}},
+	} {
+		docs, err := h.SearchAll(c.conds)
+		if err != nil {
+			t.Fatal("unexpected error when Search: ", err)
+		}
+		if !sameDocs(h, docs, c.expected) {
+			t.Errorf("unexpected docs of %v: %v, expect %v", c.conds, docs, c.expected)
+		}
+	}
+
+	var m map[string]map[string]interface{}
+	json.Unmarshal(h.DumpByDocId(), &m)
+	if m["0"]["dnf"] != s {
+		t.Error("unexpected dnf of dump: ", m["0"]["dnf"])
+	}
+	if m["0"]["simplified_dnf"] != "(region in {SH, BJ} and os in {ios})" {
+		t.Error("unexpected simplified_dnf of dump: ", m["0"]["simplified_dnf"])
+	}
+}
@@ -2,243 +2,153 @@ package godnf
 
 import (
 	"errors"
+	"strconv"
+	"sync/atomic"
+	"unicode"
+	"unsafe"
 )
 
-var leftDelimOfConj, rightDelimOfConj byte = byte('('), byte(')')
-var leftDelimOfSet, rightDelimOfSet byte = byte('{'), byte('}')
-var separatorOfSet byte = byte(',')
+// Syntax describes the delimiters of dnf, any unicode rune can be a delimiter.
+//
+// eg: with the default syntax, a dnf is like (Country in {CN, RU, US}),
+// with Syntax{'【', '】', '[', ']', '、'}, the same dnf is like 【Country in [CN、RU、US]】
+type Syntax struct {
+	LeftDelimOfConj  rune
+	RightDelimOfConj rune
+	LeftDelimOfSet   rune
+	RightDelimOfSet  rune
+	SeparatorOfSet   rune
+}
+
+// Validate returns an error if the delimiters of s can not be told from each other or from other tokens:
+// a delimiter must be a printable rune which is not a space, a double quote, '@' or a rune of operators
+// like = and <, and delimiters must be different
+func (s Syntax) Validate() error {
+	delims := []struct {
+		name string
+		r    rune
+	}{
+		{"left delim of conj", s.LeftDelimOfConj},
+		{"right delim of conj", s.RightDelimOfConj},
+		{"left delim of set", s.LeftDelimOfSet},
+		{"right delim of set", s.RightDelimOfSet},
+		{"separator of set", s.SeparatorOfSet},
+	}
+	for i, d := range delims {
+		reason := ""
+		switch {
+		case d.r == 0:
+			reason = "is not set"
+		case unicode.IsSpace(d.r) || !unicode.IsPrint(d.r):
+			reason = "is a space or not printable"
+		case d.r == '"':
+			reason = "quotes keys and values"
+		case d.r == '@':
+			reason = "references named sets"
+		case isOpChar(d.r):
+			reason = "is a rune of operators " + opChars
+		}
+		for _, prev := range delims[:i] {
+			if reason == "" && prev.r == d.r {
+				reason = "is the same as " + prev.name
+			}
+		}
+		if reason != "" {
+			return errors.New("invalid syntax: " + d.name + " " + strconv.QuoteRune(d.r) + " " + reason)
+		}
+	}
+	return nil
+}
+
+var defaultSyntax unsafe.Pointer = unsafe.Pointer(&Syntax{
+	LeftDelimOfConj:  '(',
+	RightDelimOfConj: ')',
+	LeftDelimOfSet:   '{',
+	RightDelimOfSet:  '}',
+	SeparatorOfSet:   ',',
+})
+
+// DefaultSyntax returns the syntax used by ParseDNF, DnfCheck and NewHandler
+func DefaultSyntax() Syntax {
+	return *(*Syntax)(atomic.LoadPointer(&defaultSyntax))
+}
+
+func setDefaultSyntax(f func(s *Syntax)) {
+	for {
+		old := atomic.LoadPointer(&defaultSyntax)
+		syntax := *(*Syntax)(old)
+		f(&syntax)
+		if atomic.CompareAndSwapPointer(&defaultSyntax, old, unsafe.Pointer(&syntax)) {
+			return
+		}
+	}
+}
+
+// Parse parses dnf into an Expr with this syntax
+func (s Syntax) Parse(dnf string) (*Expr, error) {
+	p := &parser{src: dnf, syntax: s}
+	return p.parse()
+}
+
+// Check check dnf syntax, a syntax error is returned as *ParseError
+func (s Syntax) Check(dnf string) error {
+	_, err := s.Parse(dnf)
+	return err
+}
 
 // SetDelimOfConj set global conj delim to left and right
+//
+// Deprecated: changing the default syntax affects every handler created afterwards,
+// use NewHandlerWithSyntax instead.
 func SetDelimOfConj(left, right rune) {
-	leftDelimOfConj, rightDelimOfConj = byte(left), byte(right)
+	setDefaultSyntax(func(s *Syntax) { s.LeftDelimOfConj, s.RightDelimOfConj = left, right })
 }
 
-//  GetDelimOfConj returns current global left and right delim of conjunction
-//  eg: if a right dnf is like (Country in {CN, RU, US}),
-//  this func will return rune('('), rune(')')
+// GetDelimOfConj returns current global left and right delim of conjunction
+// eg: if a right dnf is like (Country in {CN, RU, US}),
+// this func will return rune('('), rune(')')
+//
+// Deprecated: use DefaultSyntax instead.
 func GetDelimOfConj() (left, right rune) {
-	return rune(leftDelimOfConj), rune(rightDelimOfConj)
+	s := DefaultSyntax()
+	return s.LeftDelimOfConj, s.RightDelimOfConj
 }
 
 // SetDelimOfSet set global set delim to left and right
+//
+// Deprecated: changing the default syntax affects every handler created afterwards,
+// use NewHandlerWithSyntax instead.
 func SetDelimOfSet(left, right rune) {
-	leftDelimOfSet, rightDelimOfSet = byte(left), byte(right)
+	setDefaultSyntax(func(s *Syntax) { s.LeftDelimOfSet, s.RightDelimOfSet = left, right })
 }
 
 // GetDelimOfSet returns current global left and right delim of set
 // eg: if a dnf is like (Country in {CN, RU, US}),
 // this func will return rune('{'), rune('}')
+//
+// Deprecated: use DefaultSyntax instead.
 func GetDelimOfSet() (left, right rune) {
-	return rune(leftDelimOfSet), rune(rightDelimOfSet)
+	s := DefaultSyntax()
+	return s.LeftDelimOfSet, s.RightDelimOfSet
 }
 
 // SetSeparatorOfSet set global separator of set
+//
+// Deprecated: changing the default syntax affects every handler created afterwards,
+// use NewHandlerWithSyntax instead.
 func SetSeparatorOfSet(sep rune) {
-	separatorOfSet = byte(sep)
+	setDefaultSyntax(func(s *Syntax) { s.SeparatorOfSet = sep })
 }
 
 // GetSeparatorOfSet returns current global separator of elems in set
 // eg: the separator of set elems is rune(',') when a dnf is like (Country in {CN, RU, US})
+//
+// Deprecated: use DefaultSyntax instead.
 func GetSeparatorOfSet() rune {
-	return rune(separatorOfSet)
-}
-
-var dnfFmtError error = errors.New("dnf format error")
-
-func skipSpace(s *string, i int) int {
-	for i < len(*s) {
-		if (*s)[i] != ' ' {
-			break
-		}
-		i++
-	}
-	return i
+	return DefaultSyntax().SeparatorOfSet
 }
 
-func skipString(s *string, i int) (j int) {
-	if i >= len(*s) {
-		return len(*s)
-	}
-	for j = i + 1; j < len(*s); j++ {
-		switch (*s)[j] {
-		case ' ':
-			return
-		case separatorOfSet:
-			return
-		case leftDelimOfSet:
-			return
-		case rightDelimOfSet:
-			return
-		}
-	}
-	return
-}
-
-func getString(s *string, i int) (subStr string, endIndex int) {
-	j := skipString(s, i)
-	ASSERT(i < j)
-	return string((*s)[i:j]), j
-}
-
-func dnfIdxCheck(dnf *string, i int, errmsg string) bool {
-	if i >= len(*dnf) || i < 0 {
-		DEBUG(errmsg)
-		return false
-	}
-	return true
-}
-
-// DnfCheck check dnf syntax
+// DnfCheck check dnf syntax with the default syntax, a syntax error is returned as *ParseError
 func DnfCheck(dnf string) error {
-	return dnfStart(&dnf, skipSpace(&dnf, 0))
-}
-
-// start: get leftDelimOfConj, default is '('
-func dnfStart(dnf *string, i int) error {
-	if !dnfIdxCheck(dnf, i, "start dnf idx error") {
-		return dnfFmtError
-	}
-	if (*dnf)[i] != leftDelimOfConj {
-		DEBUG("dnf start error, dnf[", i, "] =", string((*dnf)[i]))
-		return dnfFmtError
-	}
-
-	m := make(map[string]bool)
-	return dnfState1(dnf, skipSpace(dnf, i+1), m)
-}
-
-// state1: get key
-func dnfState1(dnf *string, i int, m map[string]bool) error {
-	if !dnfIdxCheck(dnf, i, "dnfState1 check error") {
-		return dnfFmtError
-	}
-	j := skipString(dnf, i)
-	if j >= len(*dnf) {
-		DEBUG("state 1 internal error")
-		return dnfFmtError
-	}
-	key := string((*dnf)[i:j])
-	if _, ok := m[key]; ok {
-		return errors.New("conjunction key " + key + " duplicate")
-	}
-	m[key] = true
-	return dnfState2(dnf, skipSpace(dnf, j+1), m)
-}
-
-// state2: get 'not' or get 'in'
-func dnfState2(dnf *string, i int, m map[string]bool) error {
-	if !dnfIdxCheck(dnf, i, "dnfState2 check error") {
-		return dnfFmtError
-	}
-	if i+3 <= len(*dnf) && string((*dnf)[i:i+3]) == "not" {
-		return dnfState3(dnf, skipSpace(dnf, i+3), m)
-	}
-	if i+2 <= len(*dnf) && string((*dnf)[i:i+2]) == "in" {
-		return dnfState4(dnf, skipSpace(dnf, i+2), m)
-	}
-	DEBUG("state2 internal error")
-	return dnfFmtError
-}
-
-// state3: get 'in'
-func dnfState3(dnf *string, i int, m map[string]bool) error {
-	if !dnfIdxCheck(dnf, i, "dnfState3 check error") {
-		return dnfFmtError
-	}
-	if i+2 <= len(*dnf) && string((*dnf)[i:i+2]) == "in" {
-		return dnfState4(dnf, skipSpace(dnf, i+2), m)
-	}
-	DEBUG("state3 internal error")
-	return dnfFmtError
-}
-
-// state4: get leftDelimOfSet, default is '{'
-func dnfState4(dnf *string, i int, m map[string]bool) error {
-	if !dnfIdxCheck(dnf, i, "dnfState4 check error") {
-		return dnfFmtError
-	}
-	if (*dnf)[i] != leftDelimOfSet {
-		DEBUG("state4 internal error")
-		return dnfFmtError
-	}
-	return dnfState5(dnf, skipSpace(dnf, i+1), m)
-}
-
-// state5: get elem of set
-func dnfState5(dnf *string, i int, m map[string]bool) error {
-	if !dnfIdxCheck(dnf, i, "dnfState5 check error") {
-		return dnfFmtError
-	}
-
-	j := skipString(dnf, i)
-	if j >= len(*dnf) {
-		DEBUG("state5 internal error")
-		return dnfFmtError
-	}
-
-	// val := string((*dnf)[i:j])
-	// _ = val
-
-	return dnfState6(dnf, skipSpace(dnf, j), m)
-}
-
-// state6: get next val(',') or get end of set('}')
-func dnfState6(dnf *string, i int, m map[string]bool) error {
-	if !dnfIdxCheck(dnf, i, "dnfState6 check error") {
-		return dnfFmtError
-	}
-	if (*dnf)[i] == separatorOfSet {
-		return dnfState7(dnf, skipSpace(dnf, i+1), m)
-	}
-	if (*dnf)[i] == rightDelimOfSet {
-		return dnfState8(dnf, skipSpace(dnf, i+1), m)
-	}
-	DEBUG("state6 internal error")
-	return dnfFmtError
-}
-
-// state7: get next val
-func dnfState7(dnf *string, i int, m map[string]bool) error {
-	if !dnfIdxCheck(dnf, i, "dnfState7 check error") {
-		return dnfFmtError
-	}
-
-	j := skipString(dnf, i)
-	if j >= len(*dnf) {
-		DEBUG("state7 internal error")
-		return dnfFmtError
-	}
-
-	// val := string((*dnf)[i:j])
-	// _ = val
-
-	return dnfState6(dnf, skipSpace(dnf, j), m)
-}
-
-// state8: get 'and' or end of this conj(')')
-func dnfState8(dnf *string, i int, m map[string]bool) error {
-	if !dnfIdxCheck(dnf, i, "dnfState8 check error") {
-		return dnfFmtError
-	}
-	if i+3 < len(*dnf) && string((*dnf)[i:i+3]) == "and" {
-		return dnfState1(dnf, skipSpace(dnf, i+3), m)
-	}
-	if (*dnf)[i] == rightDelimOfConj {
-		return dnfState9(dnf, skipSpace(dnf, i+1), m)
-	}
-	DEBUG("state8 internal error")
-	return dnfFmtError
-}
-
-// state9: end of dnf or next conj(get "or")
-func dnfState9(dnf *string, i int, m map[string]bool) error {
-	if i == len(*dnf) {
-		// accept
-		return nil
-	}
-	if i+2 < len(*dnf) && string((*dnf)[i:i+2]) == "or" {
-		return dnfStart(dnf, skipSpace(dnf, i+2))
-	}
-	DEBUG("state9 internal error")
-	return dnfFmtError
+	return DefaultSyntax().Check(dnf)
 }
@@ -48,3 +48,90 @@ func TestDnfCheck(t *testing.T) {
 	checkDnf("(city in {SH} and city not in { BJ }) or (age in {3, 5} and city in {HZ})", false)
 	checkDnf("(city in {SH}) or (age in {3, 5} and city in {HZ}", false)
 }
+
+func TestHandlerWithSyntax(t *testing.T) {
+	setDelim()
+	cn, err := dnf.NewHandlerWithSyntax(dnf.Syntax{
+		LeftDelimOfConj:  '【',
+		RightDelimOfConj: '】',
+		LeftDelimOfSet:   '「',
+		RightDelimOfSet:  '」',
+		SeparatorOfSet:   '、',
+	}, true)
+	if err != nil {
+		t.Fatal("unexpected error when NewHandlerWithSyntax: ", err)
+	}
+	en := dnf.NewHandler()
+
+	if err := cn.AddDoc("doc-0", "0", "【城市 in 「北京、上海」 and age not in 「3」】 or 【gender in 「male」】", attr{0, "doc-0"}); err != nil {
+		t.Fatal("unexpected error when AddDoc: ", err)
+	}
+	if err := en.AddDoc("doc-0", "0", "(城市 in {北京, 上海} and age not in {3}) or (gender in {male})", attr{0, "doc-0"}); err != nil {
+		t.Fatal("unexpected error when AddDoc: ", err)
+	}
+	if err := en.AddDoc("doc-1", "1", "【城市 in 「北京、上海」】", attr{1, "doc-1"}); err == nil {
+		t.Error("expect syntax error when AddDoc with a different syntax")
+	}
+
+	for _, h := range []*dnf.Handler{cn, en} {
+		docs, err := h.SearchAll([]dnf.Cond{{Key: "城市", Val: "上海"}, {Key: "age", Val: "4"}})
+		if err != nil || len(docs) != 1 {
+			t.Errorf("unexpected search result: %v, %v", docs, err)
+		}
+		docs, err = h.SearchAll([]dnf.Cond{{Key: "城市", Val: "上海"}, {Key: "age", Val: "3"}})
+		if err != nil || len(docs) != 0 {
+			t.Errorf("unexpected search result: %v, %v", docs, err)
+		}
+	}
+	if s := cn.Syntax(); s.LeftDelimOfConj != '【' || s.SeparatorOfSet != '、' {
+		t.Errorf("unexpected syntax of handler: %+v", s)
+	}
+}
+
+func TestSyntaxValidate(t *testing.T) {
+	if err := dnf.DefaultSyntax().Validate(); err != nil {
+		t.Error("unexpected error when Validate the default syntax: ", err)
+	}
+	if err := (dnf.Syntax{'【', '】', '[', ']', '、'}).Validate(); err != nil {
+		t.Error("unexpected error when Validate: ", err)
+	}
+	for _, s := range []dnf.Syntax{
+		{},
+		{'(', ')', '{', '}', 0},
+		{'(', ')', '{', '}', ' '},
+		{'(', ')', '{', '}', '"'},
+		{'(', ')', '{', '}', '@'},
+		{'(', ')', '{', '}', '|'},
+		{'<', '>', '{', '}', ','},
+		{'(', ')', '(', ')', ','},
+		{'(', ')', '{', '}', '}'},
+	} {
+		if err := s.Validate(); err == nil {
+			t.Errorf("expect error when Validate %q", []rune{s.LeftDelimOfConj, s.RightDelimOfConj,
+				s.LeftDelimOfSet, s.RightDelimOfSet, s.SeparatorOfSet})
+		}
+		if _, err := dnf.NewHandlerWithSyntax(s, false); err == nil {
+			t.Errorf("expect error when NewHandlerWithSyntax %+v", s)
+		}
+	}
+}
+
+func TestDeprecatedDelimSetters(t *testing.T) {
+	setDelim()
+	defer setDelim()
+
+	dnf.SetDelimOfConj('【', '】')
+	if left, right := dnf.GetDelimOfConj(); left != '【' || right != '】' {
+		t.Errorf("unexpected delim of conj: %c %c", left, right)
+	}
+	h := dnf.NewHandlerWithoutLock()
+	setDelim()
+
+	// the handler keeps the syntax when it was created
+	if err := h.AddDoc("doc-0", "0", "【city in {BJ}】", attr{0, "doc-0"}); err != nil {
+		t.Error("unexpected error when AddDoc: ", err)
+	}
+	if err := dnf.DnfCheck("【city in {BJ}】"); err == nil {
+		t.Error("expect syntax error after default syntax restored")
+	}
+}
@@ -0,0 +1,162 @@
+package godnf
+
+import (
+	"encoding/csv"
+	"errors"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// Taxonomy is a hierarchy of values, possibly across keys, see Handler.SetTaxonomy:
+//
+//	city Pudong --> city Shanghai --> province SH --> country CN
+//
+// a value may have several parents, but can not be an ancestor of itself
+type Taxonomy struct {
+	parents map[Cond][]Cond
+}
+
+// NewTaxonomy returns an empty taxonomy
+func NewTaxonomy() *Taxonomy {
+	return &Taxonomy{parents: make(map[Cond][]Cond)}
+}
+
+// Add adds parent as a parent of child
+func (t *Taxonomy) Add(parent, child Cond) error {
+	if parent.Key == "" || child.Key == "" {
+		return errors.New("empty key in taxonomy")
+	}
+	if parent == child {
+		return errors.New("value " + child.ToString() + " is a parent of itself")
+	}
+	for _, p := range t.parents[child] {
+		if p == parent {
+			return nil
+		}
+	}
+	for _, a := range t.Ancestors(parent) {
+		if a == child {
+			return errors.New("value " + child.ToString() + " is an ancestor of its parent " + parent.ToString())
+		}
+	}
+	t.parents[child] = append(t.parents[child], parent)
+	return nil
+}
+
+// Ancestors returns parents of c, their parents and so on, nearest first
+func (t *Taxonomy) Ancestors(c Cond) []Cond {
+	var rc []Cond
+	seen := map[Cond]bool{c: true}
+	for i, queue := 0, []Cond{c}; i < len(queue); i++ {
+		for _, p := range t.parents[queue[i]] {
+			if !seen[p] {
+				seen[p] = true
+				rc = append(rc, p)
+				queue = append(queue, p)
+			}
+		}
+	}
+	return rc
+}
+
+// LoadTaxonomy loads a taxonomy from the csv file of path, each record is a parent and its child:
+//
+//	# parent_key,parent_val,child_key,child_val
+//	country,CN,province,SH
+//	province,SH,city,Shanghai
+//	city,Shanghai,city,Pudong
+//
+// fields are trimmed, lines starting with '#' are ignored
+func LoadTaxonomy(path string) (*Taxonomy, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	t := NewTaxonomy()
+	r := csv.NewReader(f)
+	r.Comment = '#'
+	r.FieldsPerRecord = 4
+	r.TrimLeadingSpace = true
+	for {
+		record, err := r.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		for i := range record {
+			record[i] = strings.TrimSpace(record[i])
+		}
+		parent, child := Cond{Key: record[0], Val: record[1]}, Cond{Key: record[2], Val: record[3]}
+		if err := t.Add(parent, child); err != nil {
+			line, _ := r.FieldPos(0)
+			return nil, errors.New(path + ":" + strconv.Itoa(line) + ": " + err.Error())
+		}
+	}
+	return t, nil
+}
+
+// SetTaxonomy set the taxonomy which expands each cond of Search into its ancestors, it must be called
+// after SetNormalizers, since values of the taxonomy are normalized by normalizers of their keys,
+// and SetNormalizers returns an error once a taxonomy is set:
+//
+//	h.AddDoc("ad0", "0", "(city in {Shanghai})", attr)
+//	h.AddDoc("ad1", "1", "(country in {CN} and city not in {Shanghai})", attr)
+//	h.Search([]dnf.Cond{{"city", "Pudong"}}, filter) // ad0 is found, ad1 is not
+//
+// an expanded cond matches docs like the cond itself, so excluding a value excludes its descendants,
+// and nil removes the taxonomy
+func (h *Handler) SetTaxonomy(t *Taxonomy) {
+	h.confLock.Lock()
+	defer h.confLock.Unlock()
+	if t == nil {
+		h.taxonomy = nil
+		return
+	}
+	normalize := func(c Cond) Cond {
+		for _, n := range h.normalizers[c.Key] {
+			c.Val = n.Normalize(c.Val)
+		}
+		return c
+	}
+	normalized := NewTaxonomy()
+	for child, parents := range t.parents {
+		for _, parent := range parents {
+			// normalized values of a parent and its child may be the same
+			normalized.Add(normalize(parent), normalize(child))
+		}
+	}
+	h.taxonomy = normalized
+}
+
+// expandConds returns conds with their ancestors in the taxonomy of handler, or conds itself if there are none
+func (h *Handler) expandConds(conds []Cond) []Cond {
+	h.confLock.RLock()
+	taxonomy := h.taxonomy
+	h.confLock.RUnlock()
+	if taxonomy == nil {
+		return conds
+	}
+	var rc []Cond
+	seen := make(map[Cond]bool, len(conds))
+	for _, c := range conds {
+		seen[c] = true
+	}
+	for _, c := range conds {
+		for _, a := range taxonomy.Ancestors(c) {
+			if !seen[a] {
+				seen[a] = true
+				rc = append(rc, a)
+			}
+		}
+	}
+	if len(rc) == 0 {
+		return conds
+	}
+	return append(append(make([]Cond, 0, len(conds)+len(rc)), conds...), rc...)
+}
@@ -0,0 +1,104 @@
+package godnf_test
+
+import (
+	"io/ioutil"
+	"os"
+	"testing"
+
+	dnf "github.com/brg-liuwei/godnf"
+)
+
+func TestLoadTaxonomy(t *testing.T) {
+	f, err := ioutil.TempFile("", "taxonomy")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.Remove(f.Name())
+	f.WriteString("# parent_key,parent_val,child_key,child_val\ncountry,CN,province,SH\nprovince, SH ,city,Shanghai\n" +
+		"city,Shanghai,city,Pudong\nregion,East,city,Shanghai\n")
+	f.Close()
+
+	taxonomy, err := dnf.LoadTaxonomy(f.Name())
+	if err != nil {
+		t.Fatal("unexpected error when LoadTaxonomy: ", err)
+	}
+	ancestors := taxonomy.Ancestors(dnf.Cond{"city", "Pudong"})
+	expected := []dnf.Cond{{"city", "Shanghai"}, {"province", "SH"}, {"region", "East"}, {"country", "CN"}}
+	if len(ancestors) != len(expected) {
+		t.Fatalf("unexpected ancestors: %v, expect %v", ancestors, expected)
+	}
+	for i := range expected {
+		if ancestors[i] != expected[i] {
+			t.Errorf("unexpected ancestors: %v, expect %v", ancestors, expected)
+		}
+	}
+
+	for _, s := range []string{"a,b,c\n", "city,Pudong,city,Pudong\n", "a,1,b,2\nb,2,a,1\n", ",1,b,2\n"} {
+		ioutil.WriteFile(f.Name(), []byte(s), 0644)
+		if _, err := dnf.LoadTaxonomy(f.Name()); err == nil {
+			t.Errorf("expect error when LoadTaxonomy %q", s)
+		}
+	}
+}
+
+func TestTaxonomy(t *testing.T) {
+	setDelim()
+	taxonomy := dnf.NewTaxonomy()
+	for _, edge := range [][2]dnf.Cond{
+		{{"country", "CN"}, {"province", "SH"}},
+		{{"province", "SH"}, {"city", "Shanghai"}},
+		{{"city", "Shanghai"}, {"city", "Pudong"}},
+		{{"country", "CN"}, {"city", "Beijing"}},
+	} {
+		if err := taxonomy.Add(edge[0], edge[1]); err != nil {
+			t.Fatal("unexpected error when Add: ", err)
+		}
+	}
+
+	h := dnf.NewHandler()
+	h.SetNormalizers("city", dnf.Lowercase)
+	h.SetTaxonomy(taxonomy)
+	if err := h.SetNormalizers("city", dnf.TrimSpace); err == nil {
+		t.Error("expect error when SetNormalizers after a taxonomy is set")
+	}
+	for i, s := range []string{
+		"(city in {Shanghai})",                              // docid: 0
+		"(country in {CN} and city not in {Shanghai})",      // docid: 1
+		"(province in {SH} and age in {18})",                // docid: 2
+		"(city in {Shanghai, Pudong} and age in {18})",      // docid: 3
+		"(country in {CN} and province not in {SH})",        // docid: 4
+		"(city in {Pudong} and country not in {CN})",        // docid: 5
+		"(city in {Pudong})",                                // docid: 6
+		"(province in {SH} and city in {Shanghai, Pudong})", // docid: 7
+	} {
+		if err := h.AddDoc("doc", string(rune('0'+i)), s, attr{i, "doc"}); err != nil {
+			t.Fatal("unexpected error when AddDoc: ", err)
+		}
+	}
+
+	for _, c := range []struct {
+		conds    []dnf.Cond
+		expected []int
+	}{
+		{[]dnf.Cond{{"city", "pudong"}}, []int{0, 6, 7}},
+		{[]dnf.Cond{{"city", "Pudong"}, {"age", "18"}}, []int{0, 2, 3, 6, 7}},
+		{[]dnf.Cond{{"city", "Shanghai"}}, []int{0, 7}},
+		{[]dnf.Cond{{"city", "Beijing"}}, []int{1, 4}},
+		{[]dnf.Cond{{"country", "CN"}}, []int{1, 4}},
+		{[]dnf.Cond{{"province", "SH"}, {"age", "18"}}, []int{1, 2}},
+	} {
+		docs, err := h.SearchAll(c.conds)
+		if err != nil {
+			t.Fatal("unexpected error when Search: ", err)
+		}
+		if !sameDocs(h, docs, c.expected) {
+			t.Errorf("unexpected docs of %v: %v, expect %v", c.conds, docs, c.expected)
+		}
+	}
+
+	h.SetTaxonomy(nil)
+	docs, _ := h.SearchAll([]dnf.Cond{{"city", "Pudong"}})
+	if !sameDocs(h, docs, []int{5, 6}) {
+		t.Errorf("unexpected docs without taxonomy: %v", docs)
+	}
+}
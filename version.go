@@ -0,0 +1,196 @@
+package godnf
+
+import (
+	"errors"
+	"strconv"
+	"strings"
+)
+
+// KeyType is the type of values of a key, which decides how ranges of the key compare values
+type KeyType int
+
+const (
+	NumberKey  KeyType = iota // values are numbers like 2.5, the default type
+	VersionKey                // values are semantic versions like 5.2.1 or 1.0.0-beta.2
+)
+
+// SetKeyType set the type of values of key, it should be called before adding docs:
+//
+//	h.SetKeyType("app_version", dnf.VersionKey)
+//	h.AddDoc("ad0", "0", "(app_version >= 5.2.1)", attr)
+//	h.Search([]dnf.Cond{{"app_version", "5.10.0"}}, filter) // ad0 is found
+//
+// an error is returned if ranges of key are added with another type
+func (h *Handler) SetKeyType(key string, t KeyType) error {
+	h.rangesLock.Lock()
+	defer h.rangesLock.Unlock()
+	if err := h.keyTypeChangeable(key, t); err != nil {
+		return err
+	}
+	h.setKeyType(key, t)
+	return nil
+}
+
+// KeyType returns the type of values of key
+func (h *Handler) KeyType(key string) KeyType {
+	h.rangesLock.RLock()
+	defer h.rangesLock.RUnlock()
+	return h.keyTypes[key]
+}
+
+// keyTypeChangeable returns an error if ranges of key are indexed with a type other than t,
+// h.rangesLock must be held
+func (h *Handler) keyTypeChangeable(key string, t KeyType) error {
+	if idx, ok := h.ranges[key]; ok && idx.typ != t {
+		return errors.New("type of key " + key + " can not be changed after ranges of it are added")
+	}
+	return nil
+}
+
+// setKeyType set the type of key, h.rangesLock must be held
+func (h *Handler) setKeyType(key string, t KeyType) {
+	if t == NumberKey {
+		delete(h.keyTypes, key)
+		return
+	}
+	h.keyTypes[key] = t
+}
+
+// keyTypeCheck returns an error if bounds of ranges in expr are not values of their key types
+func (h *Handler) keyTypeCheck(expr *Expr) error {
+	for _, conj := range expr.Conjs {
+		for _, amt := range conj.Amts {
+			if amt.Range == nil || amt.Bucket != nil {
+				continue
+			}
+			if msg, ok := amt.Range.check(h.KeyType(amt.Key)); !ok {
+				return errors.New("key " + amt.Key + ": " + msg)
+			}
+		}
+	}
+	return nil
+}
+
+// version is a semantic version, the numeric parts are compared one by one,
+// missing parts are zeros and a pre-release version is lower than its release:
+//
+//	1.0.0-alpha < 1.0.0-alpha.1 < 1.0.0-beta < 1.0.0 == 1.0 < 1.2 < 1.10
+type version struct {
+	nums []int64
+	pre  []string
+}
+
+var versionSyntaxError error = errors.New("invalid version")
+
+// parseVersion parses a version like 5.2.1, v5.2 or 1.0.0-beta.2+build.5, build metadata is ignored
+func parseVersion(s string) (*version, error) {
+	str := strings.TrimPrefix(strings.TrimPrefix(s, "v"), "V")
+	if i := strings.IndexByte(str, '+'); i >= 0 {
+		str = str[:i]
+	}
+	v := &version{}
+	if i := strings.IndexByte(str, '-'); i >= 0 {
+		v.pre = strings.Split(str[i+1:], ".")
+		for _, id := range v.pre {
+			if id == "" {
+				return nil, &strconv.NumError{Func: "parseVersion", Num: s, Err: versionSyntaxError}
+			}
+		}
+		str = str[:i]
+	}
+	for _, part := range strings.Split(str, ".") {
+		n, err := strconv.ParseUint(part, 10, 63)
+		if err != nil {
+			return nil, &strconv.NumError{Func: "parseVersion", Num: s, Err: versionSyntaxError}
+		}
+		v.nums = append(v.nums, int64(n))
+	}
+	return v, nil
+}
+
+func (v *version) compare(o bound) int {
+	w := o.(*version)
+	for i := 0; i < len(v.nums) || i < len(w.nums); i++ {
+		var x, y int64
+		if i < len(v.nums) {
+			x = v.nums[i]
+		}
+		if i < len(w.nums) {
+			y = w.nums[i]
+		}
+		if x != y {
+			return compareInt(x, y)
+		}
+	}
+
+	switch {
+	case len(v.pre) == 0 && len(w.pre) == 0:
+		return 0
+	case len(v.pre) == 0:
+		return 1
+	case len(w.pre) == 0:
+		return -1
+	}
+	for i := 0; i < len(v.pre) && i < len(w.pre); i++ {
+		if c := comparePreRelease(v.pre[i], w.pre[i]); c != 0 {
+			return c
+		}
+	}
+	return compareInt(int64(len(v.pre)), int64(len(w.pre)))
+}
+
+// comparePreRelease compares identifiers of pre-release,
+// numeric identifiers are compared numerically and lower than alphanumeric ones
+func comparePreRelease(a, b string) int {
+	numa, numb := isDigits(a), isDigits(b)
+	switch {
+	case numa && numb:
+		// numbers of any size are compared by length and then lexically
+		a, b = strings.TrimLeft(a, "0"), strings.TrimLeft(b, "0")
+		if c := compareInt(int64(len(a)), int64(len(b))); c != 0 {
+			return c
+		}
+	case numa:
+		return -1
+	case numb:
+		return 1
+	}
+	return strings.Compare(a, b)
+}
+
+// isDigits reports whether s is a non-empty string of decimal digits
+func isDigits(s string) bool {
+	for i := 0; i < len(s); i++ {
+		if s[i] < '0' || s[i] > '9' {
+			return false
+		}
+	}
+	return s != ""
+}
+
+func compareInt(x, y int64) int {
+	switch {
+	case x < y:
+		return -1
+	case x > y:
+		return 1
+	}
+	return 0
+}
+
+// String returns the canonical version without trailing zero parts: 5.2.0 --> 5.2
+func (v *version) String() string {
+	n := len(v.nums)
+	for n > 1 && v.nums[n-1] == 0 {
+		n--
+	}
+	parts := make([]string, 0, n)
+	for _, num := range v.nums[:n] {
+		parts = append(parts, strconv.FormatInt(num, 10))
+	}
+	s := strings.Join(parts, ".")
+	if len(v.pre) != 0 {
+		s += "-" + strings.Join(v.pre, ".")
+	}
+	return s
+}
@@ -0,0 +1,112 @@
+package godnf_test
+
+import (
+	"testing"
+
+	dnf "github.com/brg-liuwei/godnf"
+)
+
+func TestVersionRetrieval(t *testing.T) {
+	h := dnf.NewHandlerWithoutLock()
+	h.SetKeyType("app_version", dnf.VersionKey)
+	h.SetKeyType("sdk_version", dnf.VersionKey)
+	if h.KeyType("app_version") != dnf.VersionKey || h.KeyType("age") != dnf.NumberKey {
+		t.Error("unexpected key types")
+	}
+
+	for i, s := range []string{
+		"(app_version >= 5.2.1)",                           // docid: 0
+		"(sdk_version in [3.0, 4.0))",                      // docid: 1
+		"(app_version not in [5.0, 5.10) and os in {ios})", // docid: 2
+		"(app_version < 1.0.0)",                            // docid: 3
+	} {
+		if err := h.AddDoc("doc", string(rune('0'+i)), s, attr{i, "doc"}); err != nil {
+			t.Fatal("unexpected error when AddDoc: ", err)
+		}
+	}
+	if err := h.AddDoc("doc", "4", "(age >= 5.2.1)", attr{4, "doc"}); err == nil {
+		t.Error("expect error when AddDoc a version range of a number key")
+	}
+	if err := h.AddDoc("doc", "4", "(app_version in [5.10, 5.9))", attr{4, "doc"}); err == nil {
+		t.Error("expect error when AddDoc an empty version range")
+	}
+
+	for _, c := range []struct {
+		conds    []dnf.Cond
+		expected []int
+	}{
+		{[]dnf.Cond{{"app_version", "5.10.0"}, {"os", "ios"}}, []int{0, 2}},
+		{[]dnf.Cond{{"app_version", "5.9.3"}, {"os", "ios"}}, []int{0}},
+		{[]dnf.Cond{{"app_version", "5.2"}, {"os", "ios"}}, []int{}},
+		{[]dnf.Cond{{"app_version", "5.2.1"}}, []int{0}},
+		{[]dnf.Cond{{"app_version", "v5.2.1+build.7"}}, []int{0}},
+		{[]dnf.Cond{{"app_version", "5.2.1-beta"}}, []int{}},
+		{[]dnf.Cond{{"app_version", "1.0.0-rc.1"}}, []int{3}},
+		{[]dnf.Cond{{"sdk_version", "3.10"}}, []int{1}},
+		{[]dnf.Cond{{"sdk_version", "4"}}, []int{}},
+		{[]dnf.Cond{{"app_version", "unknown"}, {"os", "ios"}}, []int{2}},
+	} {
+		docs, err := h.SearchAll(c.conds)
+		if err != nil {
+			t.Fatal("unexpected error when Search: ", err)
+		}
+		if !sameDocs(h, docs, c.expected) {
+			t.Errorf("unexpected docs of %v: %v, expect %v", c.conds, docs, c.expected)
+		}
+	}
+
+	// types of keys can not be changed once ranges of them are added
+	if err := h.SetKeyType("app_version", dnf.NumberKey); err == nil {
+		t.Error("expect error when SetKeyType of a key with ranges")
+	}
+	if err := h.SetSchema(&dnf.Schema{Keys: []dnf.KeySchema{{Key: "sdk_version", Type: dnf.IntType}}}); err == nil {
+		t.Error("expect error when SetSchema changes type of a key with ranges")
+	}
+	if err := h.SetKeyType("app_version", dnf.VersionKey); err != nil {
+		t.Error("unexpected error when SetKeyType: ", err)
+	}
+	if err := h.SetKeyType("os", dnf.VersionKey); err != nil {
+		t.Error("unexpected error when SetKeyType: ", err)
+	}
+	if h.KeyType("app_version") != dnf.VersionKey || h.Schema() != nil {
+		t.Error("unexpected key types after SetKeyType failed")
+	}
+	if docs, _ := h.SearchAll([]dnf.Cond{{"app_version", "5.10.0"}}); !sameDocs(h, docs, []int{0}) {
+		t.Error("unexpected docs after SetKeyType failed: ", docs)
+	}
+}
+
+func TestParseVersionRange(t *testing.T) {
+	setDelim()
+	if got, err := dnf.FormatDNF("(app_version >= 5.2.1 and sdk_version in [3.0, 4.0))"); err != nil {
+		t.Error("unexpected error when FormatDNF: ", err)
+	} else if got != "(app_version >= 5.2.1 and sdk_version in [3.0, 4.0))" {
+		t.Error("unexpected dnf: ", got)
+	}
+	for _, s := range []string{
+		"(app_version >= 5..1)",
+		"(app_version in [6.0.0, 5.2.1])",
+		"(app_version in [1.0.0, 1.0.0-beta])",
+		"(app_version in [1.0.0-9223372036854775808, 1.0.0-9223372036854775807])",
+		"(app_version in [1.0.0-18446744073709551616, 1.0.0-9223372036854775808])",
+	} {
+		if err := dnf.DnfCheck(s); err == nil {
+			t.Error("expect error when DnfCheck: ", s)
+		}
+	}
+	// numeric identifiers of pre-release of any size are compared numerically
+	if err := dnf.DnfCheck("(app_version in [1.0.0-9223372036854775807, 1.0.0-18446744073709551616.beta])"); err != nil {
+		t.Error("unexpected error when DnfCheck: ", err)
+	}
+
+	// versions are compared by semver rules in boolean expressions
+	b, err := dnf.ParseBoolExpr("app_version >= 1.2.0 and app_version < 1.10 and app_version in {1.9, 1.10.1, 1.1}")
+	if err != nil {
+		t.Fatal("unexpected error when ParseBoolExpr: ", err)
+	}
+	if expr, err := b.DNF(dnf.DefaultMaxConjunctions); err != nil {
+		t.Error("unexpected error when DNF: ", err)
+	} else if expr.String() != "(app_version in {1.9})" {
+		t.Error("unexpected dnf: ", expr.String())
+	}
+}
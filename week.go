@@ -0,0 +1,328 @@
+package godnf
+
+import (
+	"errors"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Clock tells the time when time predicates are evaluated,
+// it can be replaced by a fake clock in tests, see Handler.SetClock
+type Clock interface {
+	Now() time.Time
+}
+
+type systemClock struct{}
+
+func (systemClock) Now() time.Time {
+	return time.Now()
+}
+
+// SetClock set the clock of time predicates
+func (h *Handler) SetClock(clock Clock) {
+	h.confLock.Lock()
+	h.clock = clock
+	h.confLock.Unlock()
+}
+
+// now returns the time of the clock of handler
+func (h *Handler) now() time.Time {
+	h.confLock.RLock()
+	clock := h.clock
+	h.confLock.RUnlock()
+	return clock.Now()
+}
+
+// weekWindow is a weekly time window like Mon-Fri 09:00-18:00 Asia/Shanghai,
+// a window whose end is not after its start crosses midnight, like Fri-Sat 22:00-02:00
+type weekWindow struct {
+	fromDay, toDay time.Weekday // days of the start of window, Fri-Mon wraps the week
+	from, to       int          // minutes of day, [from, to)
+	loc            *time.Location
+}
+
+var weekDays = []string{"Sun", "Mon", "Tue", "Wed", "Thu", "Fri", "Sat"}
+
+// parseWeekWindow parses DAYS [HH:MM-HH:MM] [TIMEZONE] like Mon-Fri 09:00-18:00 Asia/Shanghai,
+// the window lasts all day if time is omitted, and the timezone is UTC if omitted
+func parseWeekWindow(s string) (*weekWindow, error) {
+	fields := strings.Fields(s)
+	if len(fields) == 0 || len(fields) > 3 {
+		return nil, errors.New("invalid week window " + strconv.Quote(s))
+	}
+	w := &weekWindow{from: 0, to: 24 * 60, loc: time.UTC}
+
+	from, to := fields[0], fields[0]
+	if i := strings.IndexByte(fields[0], '-'); i >= 0 {
+		from, to = fields[0][:i], fields[0][i+1:]
+	}
+	var ok bool
+	if w.fromDay, ok = parseWeekDay(from); !ok {
+		return nil, errors.New("invalid week day " + strconv.Quote(from))
+	}
+	if w.toDay, ok = parseWeekDay(to); !ok {
+		return nil, errors.New("invalid week day " + strconv.Quote(to))
+	}
+
+	rest := fields[1:]
+	if len(rest) != 0 && strings.Contains(rest[0], ":") {
+		i := strings.IndexByte(rest[0], '-')
+		if i < 0 {
+			return nil, errors.New("invalid time window " + strconv.Quote(rest[0]))
+		}
+		if w.from, ok = parseMinutes(rest[0][:i]); !ok || w.from == 24*60 {
+			return nil, errors.New("invalid time " + strconv.Quote(rest[0][:i]))
+		}
+		if w.to, ok = parseMinutes(rest[0][i+1:]); !ok {
+			return nil, errors.New("invalid time " + strconv.Quote(rest[0][i+1:]))
+		}
+		if w.from == w.to {
+			return nil, errors.New("empty time window " + strconv.Quote(rest[0]))
+		}
+		rest = rest[1:]
+	}
+	switch len(rest) {
+	case 0:
+	case 1:
+		loc, err := time.LoadLocation(rest[0])
+		if err != nil {
+			return nil, errors.New("invalid timezone " + strconv.Quote(rest[0]))
+		}
+		w.loc = loc
+	default:
+		return nil, errors.New("invalid week window " + strconv.Quote(s))
+	}
+	return w, nil
+}
+
+// parseWeekDay parses a day like Mon or Monday, ignoring case
+func parseWeekDay(s string) (time.Weekday, bool) {
+	for day := time.Sunday; day <= time.Saturday; day++ {
+		if len(s) >= 3 && strings.HasPrefix(strings.ToLower(day.String()), strings.ToLower(s)) {
+			return day, true
+		}
+	}
+	return 0, false
+}
+
+// parseMinutes parses HH:MM from 00:00 to 24:00 in minutes
+func parseMinutes(s string) (int, bool) {
+	i := strings.IndexByte(s, ':')
+	if i < 1 || len(s)-i != 3 {
+		return 0, false
+	}
+	hour, err1 := strconv.Atoi(s[:i])
+	min, err2 := strconv.Atoi(s[i+1:])
+	if err1 != nil || err2 != nil || hour < 0 || min < 0 || min > 59 || hour*60+min > 24*60 {
+		return 0, false
+	}
+	return hour*60 + min, true
+}
+
+// hasDay reports whether day is in the days of w
+func (w *weekWindow) hasDay(day time.Weekday) bool {
+	if w.fromDay <= w.toDay {
+		return w.fromDay <= day && day <= w.toDay
+	}
+	return day >= w.fromDay || day <= w.toDay
+}
+
+func (w *weekWindow) contains(t time.Time) bool {
+	t = t.In(w.loc)
+	day, min := t.Weekday(), t.Hour()*60+t.Minute()
+	if w.from < w.to {
+		return w.hasDay(day) && w.from <= min && min < w.to
+	}
+	// crosses midnight, the window belongs to the day it starts
+	return (w.hasDay(day) && min >= w.from) || (w.hasDay((day+6)%7) && min < w.to)
+}
+
+// String returns the canonical window like Mon-Fri 09:00-18:00 Asia/Shanghai
+func (w *weekWindow) String() string {
+	s := weekDays[w.fromDay]
+	if w.toDay != w.fromDay {
+		s += "-" + weekDays[w.toDay]
+	}
+	if w.from != 0 || w.to != 24*60 {
+		s += " " + formatMinutes(w.from) + "-" + formatMinutes(w.to)
+	}
+	if w.loc != time.UTC {
+		s += " " + w.loc.String()
+	}
+	return s
+}
+
+func formatMinutes(min int) string {
+	h, m := strconv.Itoa(min/60), strconv.Itoa(min%60)
+	if len(h) == 1 {
+		h = "0" + h
+	}
+	if len(m) == 1 {
+		m = "0" + m
+	}
+	return h + ":" + m
+}
+
+// week: week {Mon-Fri 09:00-18:00 Asia/Shanghai, Sat-Sun}
+func (p *parser) parseWeek() ([]string, error) {
+	p.skipSpace()
+	if p.peek() != p.syntax.LeftDelimOfSet {
+		return nil, p.errorAt(p.pos, string(p.syntax.LeftDelimOfSet))
+	}
+	p.next()
+
+	windows := make([]string, 0, 1)
+	for {
+		p.skipSpace()
+		start := p.pos
+		window := strings.TrimSpace(p.scan(func(r rune) bool {
+			return r == p.syntax.SeparatorOfSet || r == p.syntax.RightDelimOfSet
+		}))
+		if window == "" {
+			return nil, p.errorAt(start, "week window")
+		}
+		if _, err := parseWeekWindow(window); err != nil {
+			perr := p.errorAt(start)
+			perr.Msg = err.Error()
+			return nil, perr
+		}
+		windows = append(windows, window)
+
+		switch p.peek() {
+		case p.syntax.SeparatorOfSet:
+			p.next()
+		case p.syntax.RightDelimOfSet:
+			p.next()
+			return windows, nil
+		default:
+			return nil, p.errorAt(p.pos, string(p.syntax.SeparatorOfSet), string(p.syntax.RightDelimOfSet))
+		}
+	}
+}
+
+// printWeek prints windows like week {Mon-Fri 09:00-18:00 Asia/Shanghai, Sat-Sun}
+func (s Syntax) printWeek(windows []string) string {
+	return "week " + string(s.LeftDelimOfSet) +
+		strings.Join(windows, string(s.SeparatorOfSet)+" ") + string(s.RightDelimOfSet)
+}
+
+// canonicalWeek returns the canonical windows, which must be valid
+func canonicalWeek(windows []string) string {
+	ss := make([]string, 0, len(windows))
+	for _, window := range windows {
+		w, _ := parseWeekWindow(window)
+		ss = append(ss, w.String())
+	}
+	return "{" + strings.Join(ss, ", ") + "}"
+}
+
+// weekSpan is a span of a week term in minutes of week, [from, to)
+type weekSpan struct {
+	from, to int
+	termId   int
+}
+
+// weekIndex indexes spans of week terms in a timezone by hours of week,
+// so a lookup only visits spans of the hour of the time
+type weekIndex struct {
+	loc   *time.Location
+	slots [7 * 24][]weekSpan
+}
+
+// spans returns spans of w in minutes of week, Sunday 00:00 is 0
+func (w *weekWindow) spans(spans [][2]int) [][2]int {
+	for day := time.Sunday; day <= time.Saturday; day++ {
+		if !w.hasDay(day) {
+			continue
+		}
+		start := int(day) * 24 * 60
+		if w.from < w.to {
+			spans = append(spans, [2]int{start + w.from, start + w.to})
+			continue
+		}
+		// crosses midnight, the end of window is in the next day
+		next := int((day+1)%7) * 24 * 60
+		spans = append(spans, [2]int{start + w.from, start + 24*60}, [2]int{next, next + w.to})
+	}
+	return spans
+}
+
+func (idx *weekIndex) add(spans [][2]int, termId int) {
+	// merge spans, so at most one span of the term contains a time
+	sort.Slice(spans, func(i, j int) bool { return spans[i][0] < spans[j][0] })
+	merged := spans[:0]
+	for _, sp := range spans {
+		if n := len(merged); n != 0 && sp[0] <= merged[n-1][1] {
+			if sp[1] > merged[n-1][1] {
+				merged[n-1][1] = sp[1]
+			}
+			continue
+		}
+		merged = append(merged, sp)
+	}
+	for _, sp := range merged {
+		for hour := sp[0] / 60; hour <= (sp[1]-1)/60; hour++ {
+			idx.slots[hour] = append(idx.slots[hour], weekSpan{from: sp[0], to: sp[1], termId: termId})
+		}
+	}
+}
+
+// lookup appends ids of terms whose spans contain t to ids
+func (idx *weekIndex) lookup(t time.Time, ids []int) []int {
+	t = t.In(idx.loc)
+	min := int(t.Weekday())*24*60 + t.Hour()*60 + t.Minute()
+	for _, sp := range idx.slots[min/60] {
+		if sp.from <= min && min < sp.to {
+			ids = append(ids, sp.termId)
+		}
+	}
+	return ids
+}
+
+// weekIndexAdd indexes week term with its windows, which must be valid
+func (h *Handler) weekIndexAdd(windows []string, termId int) {
+	h.weeksLock.Lock()
+	defer h.weeksLock.Unlock()
+	if h.weekTerms[termId] {
+		return
+	}
+	h.weekTerms[termId] = true
+
+	spans := make(map[string][][2]int)
+	for _, window := range windows {
+		w, _ := parseWeekWindow(window)
+		tz := w.loc.String()
+		spans[tz] = w.spans(spans[tz])
+		if _, ok := h.weeks[tz]; !ok {
+			h.weeks[tz] = &weekIndex{loc: w.loc}
+		}
+	}
+	for tz, ss := range spans {
+		h.weeks[tz].add(ss, termId)
+	}
+}
+
+// weekLookup appends ids of week terms whose windows contain t to termids
+func (h *Handler) weekLookup(t time.Time, termids []int) []int {
+	h.weeksLock.RLock()
+	defer h.weeksLock.RUnlock()
+	n := len(termids)
+	for _, idx := range h.weeks {
+		termids = idx.lookup(t, termids)
+	}
+	if len(h.weeks) < 2 {
+		return termids
+	}
+	// a term with windows of several timezones may be found more than once
+	found := make(map[int]bool, len(termids)-n)
+	ids := termids[:n]
+	for _, id := range termids[n:] {
+		if !found[id] {
+			found[id] = true
+			ids = append(ids, id)
+		}
+	}
+	return ids
+}
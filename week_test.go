@@ -0,0 +1,150 @@
+package godnf_test
+
+import (
+	"testing"
+	"time"
+
+	dnf "github.com/brg-liuwei/godnf"
+)
+
+type fakeClock struct {
+	now time.Time
+}
+
+func (c *fakeClock) Now() time.Time {
+	return c.now
+}
+
+func TestParseWeek(t *testing.T) {
+	setDelim()
+	s := "(time in week {Mon-Fri 09:00-18:00 Asia/Shanghai, Sat-Sun} and region in {SH})"
+	if got, err := dnf.FormatDNF(s); err != nil {
+		t.Error("unexpected error when FormatDNF: ", err)
+	} else if got != "(region in {SH} and time in week {Mon-Fri 09:00-18:00 Asia/Shanghai, Sat-Sun})" {
+		t.Error("unexpected dnf: ", got)
+	}
+
+	b, err := dnf.DNFToJSON("(time not in week {Fri-Sat 22:00-02:00})")
+	if err != nil {
+		t.Fatal("unexpected error when DNFToJSON: ", err)
+	}
+	if string(b) != `{"or":[{"and":[{"key":"time","not_in_week":["Fri-Sat 22:00-02:00"]}]}]}` {
+		t.Error("unexpected json: ", string(b))
+	}
+	if _, err := dnf.JSONToDNF([]byte(`{"or":[{"and":[{"key":"time","in_week":["Mon 25:00-26:00"]}]}]}`)); err == nil {
+		t.Error("expect error when JSONToDNF an invalid week window")
+	}
+
+	for _, s := range []string{
+		"(time in week {})",
+		"(time in week {Mo-Fr})",
+		"(time in week {Mon-Fri 09:00})",
+		"(time in week {Mon-Fri 09:00-09:00})",
+		"(time in week {Mon-Fri 09:00-18:60})",
+		"(time in week {Mon-Fri 09:00-18:00 Mars/Olympus})",
+		"(time in weeks {Mon-Fri})",
+	} {
+		if err := dnf.DnfCheck(s); err == nil {
+			t.Error("expect error when DnfCheck: ", s)
+		}
+	}
+}
+
+func TestWeekRetrieval(t *testing.T) {
+	shanghai, err := time.LoadLocation("Asia/Shanghai")
+	if err != nil {
+		t.Skip("no timezone database: ", err)
+	}
+
+	h := dnf.NewHandlerWithoutLock()
+	clock := &fakeClock{}
+	h.SetClock(clock)
+	for i, s := range []string{
+		"(region in {SH} and time in week {Mon-Fri 09:00-18:00 Asia/Shanghai})", // docid: 0
+		"(time in week {Fri-Sat 22:00-02:00})",                                  // docid: 1
+		"(region in {SH} and time not in week {Sat-Sun})",                       // docid: 2
+	} {
+		if err := h.AddDoc("doc", string(rune('0'+i)), s, attr{i, "doc"}); err != nil {
+			t.Fatal("unexpected error when AddDoc: ", err)
+		}
+	}
+
+	conds := []dnf.Cond{{"region", "SH"}}
+	for _, c := range []struct {
+		now      time.Time
+		expected []int
+	}{
+		{time.Date(2024, 1, 1, 10, 0, 0, 0, shanghai), []int{0, 2}}, // Mon
+		{time.Date(2024, 1, 1, 8, 59, 0, 0, shanghai), []int{2}},
+		{time.Date(2024, 1, 6, 10, 0, 0, 0, shanghai), []int{}},                 // Sat
+		{time.Date(2024, 1, 5, 23, 0, 0, 0, time.UTC), []int{1, 2}},             // Fri
+		{time.Date(2024, 1, 7, 1, 59, 0, 0, time.UTC), []int{1}},                // Sun, window of Sat
+		{time.Date(2024, 1, 8, 1, 0, 0, 0, time.UTC), []int{0, 2}},              // Mon 09:00 in Shanghai
+		{time.Date(2024, 1, 8, 2, 0, 0, 0, time.UTC).In(shanghai), []int{0, 2}}, // the same instant
+	} {
+		clock.now = c.now
+		docs, err := h.SearchAll(conds)
+		if err != nil {
+			t.Fatal("unexpected error when Search: ", err)
+		}
+		if !sameDocs(h, docs, c.expected) {
+			t.Errorf("unexpected docs at %v: %v, expect %v", c.now, docs, c.expected)
+		}
+	}
+
+	// explicit time of search options takes precedence over clock
+	clock.now = time.Date(2024, 1, 6, 10, 0, 0, 0, shanghai)
+	opts := dnf.SearchOptions{Time: time.Date(2024, 1, 1, 10, 0, 0, 0, shanghai)}
+	docs, err := h.SearchWithOptions(conds, func(dnf.DocAttr) bool { return true }, opts)
+	if err != nil {
+		t.Fatal("unexpected error when SearchWithOptions: ", err)
+	}
+	if !sameDocs(h, docs, []int{0, 2}) {
+		t.Errorf("unexpected docs of search options: %v", docs)
+	}
+}
+
+func TestWeekIndex(t *testing.T) {
+	if _, err := time.LoadLocation("Asia/Shanghai"); err != nil {
+		t.Skip("no timezone database: ", err)
+	}
+
+	h := dnf.NewHandlerWithoutLock()
+	clock := &fakeClock{}
+	h.SetClock(clock)
+	for i, s := range []string{
+		// overlapping windows of a term in several timezones
+		"(region in {SH} and time in week {Mon-Fri 09:00-18:00 Asia/Shanghai, Mon 17:00-20:00 Asia/Shanghai, Mon 01:00-02:00})", // docid: 0
+		"(time in week {Sat 23:00-01:00, Sun 00:30-03:00})",                                                                     // docid: 1
+		"(region in {SH} and time not in week {Sat 23:00-01:00, Sun 00:30-03:00})",                                              // docid: 2
+	} {
+		if err := h.AddDoc("doc", string(rune('0'+i)), s, attr{i, "doc"}); err != nil {
+			t.Fatal("unexpected error when AddDoc: ", err)
+		}
+	}
+
+	conds := []dnf.Cond{{"region", "SH"}}
+	for _, c := range []struct {
+		now      time.Time
+		expected []int
+	}{
+		{time.Date(2024, 1, 1, 1, 30, 0, 0, time.UTC), []int{0, 2}}, // Mon 09:30 in Shanghai
+		{time.Date(2024, 1, 1, 11, 0, 0, 0, time.UTC), []int{0, 2}}, // Mon 19:00 in Shanghai
+		{time.Date(2024, 1, 1, 12, 30, 0, 0, time.UTC), []int{2}},
+		{time.Date(2024, 1, 2, 1, 30, 0, 0, time.UTC), []int{0, 2}},
+		{time.Date(2024, 1, 6, 22, 59, 0, 0, time.UTC), []int{2}}, // Sat
+		{time.Date(2024, 1, 6, 23, 0, 0, 0, time.UTC), []int{1}},
+		{time.Date(2024, 1, 7, 0, 45, 0, 0, time.UTC), []int{1}}, // Sun
+		{time.Date(2024, 1, 7, 2, 59, 0, 0, time.UTC), []int{1}},
+		{time.Date(2024, 1, 7, 3, 0, 0, 0, time.UTC), []int{2}},
+	} {
+		clock.now = c.now
+		docs, err := h.SearchAll(conds)
+		if err != nil {
+			t.Fatal("unexpected error when Search: ", err)
+		}
+		if !sameDocs(h, docs, c.expected) {
+			t.Errorf("unexpected docs at %v: %v, expect %v", c.now, docs, c.expected)
+		}
+	}
+}